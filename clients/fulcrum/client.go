@@ -11,37 +11,54 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"golang.org/x/oauth2"
 )
 
 type FulcrumApi interface {
 
 	// seeding functions, that should be invoked sequentially as soon as the provisioner comes up
-	CreateServiceType(id string, name string) (string, error)
-	CreateAgentType(serviceTypeId string, name string) (string, error)
+	CreateServiceType(id string, name string, propertySchema map[string]interface{}) (string, error)
+	CreateAgentType(serviceTypeIds []string, name string, configurationSchema map[string]interface{}) (string, error)
 	CreateParticipant(name string) (string, error)
 	CreateServiceGroup(providerId string, name string) (string, error)
 	CreateAgent(agentData model.AgentData) (string, error)
-	CreateAgentToken(agentId string, tokenName string) (string, error)
+	CreateAgentToken(agentId string, tokenName string, expireAt time.Time) (*model.TokenData, error)
 	ListTokens() ([]model.TokenInformation, error)
+	// lookup and update functions, with which seeding only creates what is missing and updates what has drifted
+	ListServiceTypes() ([]model.ServiceTypeData, error)
+	UpdateServiceType(id string, name string, propertySchema map[string]interface{}) error
+	ListAgentTypes() ([]model.AgentTypeData, error)
+	UpdateAgentType(id string, serviceTypeIds []string, name string, configurationSchema map[string]interface{}) error
+	ListParticipants() ([]model.ParticipantData, error)
+	ListServiceGroups() ([]model.ServiceGroupData, error)
+	ListAgents() ([]model.AgentData, error)
+	UpdateAgent(id string, agentData model.AgentData) error
 	RegenerateToken(tokenId string) (*model.TokenData, error)
+	DeleteToken(tokenId string) error
 	// these functions are invoked by the provisioner to get and process jobs
 	GetPendingJobs(agentToken string) ([]model.PendingJob, error)
 	ClaimJob(agentToken string, jobId string) error
-	FinalizeJob(agentToken string, jobId string) error
+	FinalizeJob(agentToken string, jobId string, result model.JobResult) error
+	// FailJob marks a claimed job as failed, the message is shown for the service in Fulcrum Core
+	FailJob(agentToken string, jobId string, errorMessage string) error
 }
 
+// todo: make configurable
+const listPageSize = 100
+
 type FulcrumApiClient struct {
 	config.ApiConfig
+	// AdminCredentials authenticate the administrative requests, the job requests use the agent token instead
+	AdminCredentials oauth2.TokenSource
 }
 
-func NewFulcrumApiClient(baseUrl string) FulcrumApi {
+func NewFulcrumApiClient(baseUrl string, adminCredentials oauth2.TokenSource) FulcrumApi {
 	return &FulcrumApiClient{
 		ApiConfig: config.ApiConfig{
-			ApiKey:     "change-me",
 			HttpClient: config.CreateHttpClient(),
 			BaseUrl:    baseUrl,
 		},
+		AdminCredentials: adminCredentials,
 	}
 }
 
@@ -49,13 +66,17 @@ type IdResponse struct {
 	Id string `json:"id"`
 }
 
-func (f *FulcrumApiClient) CreateServiceType(id string, name string) (string, error) {
+func (f *FulcrumApiClient) CreateServiceType(id string, name string, propertySchema map[string]interface{}) (string, error) {
 
-	body := `{
-		"id": "` + id + `",
-		"name": "` + name + `"
-	}`
-	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/service-types", strings.NewReader(body))
+	body, err := json.Marshal(map[string]interface{}{
+		"id":             id,
+		"name":           name,
+		"propertySchema": propertySchema,
+	})
+	if err != nil {
+		return "", err
+	}
+	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/service-types", bytes.NewReader(body))
 	if err != nil {
 		return "", err
 	}
@@ -72,12 +93,16 @@ func (f *FulcrumApiClient) CreateServiceType(id string, name string) (string, er
 	return r.Id, nil
 }
 
-func (f *FulcrumApiClient) CreateAgentType(serviceTypeId string, name string) (string, error) {
-	body := `{
-		"serviceTypeIds": ["` + serviceTypeId + `"],
-		"name": "` + name + `"
-	}`
-	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/agent-types", strings.NewReader(body))
+func (f *FulcrumApiClient) CreateAgentType(serviceTypeIds []string, name string, configurationSchema map[string]interface{}) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"serviceTypeIds":      serviceTypeIds,
+		"name":                name,
+		"configurationSchema": configurationSchema,
+	})
+	if err != nil {
+		return "", err
+	}
+	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/agent-types", bytes.NewReader(body))
 	if err != nil {
 		return "", err
 	}
@@ -161,28 +186,31 @@ func (f *FulcrumApiClient) CreateAgent(agentData model.AgentData) (string, error
 	return r.Id, nil
 }
 
-func (f *FulcrumApiClient) CreateAgentToken(agentId string, tokenName string) (string, error) {
-	body := `{
-		"scopeId": "` + agentId + `",
-		"name": "` + tokenName + `",
-		"role": "agent",
-        "expireAt": "` + time.Now().Add(time.Hour*24*365).Format(time.RFC3339) + `"
-	}`
-	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/tokens", strings.NewReader(body))
+func (f *FulcrumApiClient) CreateAgentToken(agentId string, tokenName string, expireAt time.Time) (*model.TokenData, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"scopeId":  agentId,
+		"name":     tokenName,
+		"role":     "agent",
+		"expireAt": expireAt.UTC().Format(time.RFC3339),
+	})
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/tokens", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
 	}
 
 	response, err := f.requestWithResponse(rq)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	r := model.TokenData{}
 	err = json.Unmarshal(response, &r)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return r.Value, nil
+	return &r, nil
 }
 
 func (f *FulcrumApiClient) ListTokens() ([]model.TokenInformation, error) {
@@ -206,6 +234,86 @@ func (f *FulcrumApiClient) ListTokens() ([]model.TokenInformation, error) {
 	return response.Items, nil
 }
 
+func (f *FulcrumApiClient) ListServiceTypes() ([]model.ServiceTypeData, error) {
+	return listAll[model.ServiceTypeData](f, "/api/v1/service-types")
+}
+
+func (f *FulcrumApiClient) UpdateServiceType(id string, name string, propertySchema map[string]interface{}) error {
+	return f.patch("/api/v1/service-types/"+id, map[string]interface{}{
+		"name":           name,
+		"propertySchema": propertySchema,
+	})
+}
+
+func (f *FulcrumApiClient) ListAgentTypes() ([]model.AgentTypeData, error) {
+	return listAll[model.AgentTypeData](f, "/api/v1/agent-types")
+}
+
+func (f *FulcrumApiClient) UpdateAgentType(id string, serviceTypeIds []string, name string, configurationSchema map[string]interface{}) error {
+	return f.patch("/api/v1/agent-types/"+id, map[string]interface{}{
+		"serviceTypeIds":      serviceTypeIds,
+		"name":                name,
+		"configurationSchema": configurationSchema,
+	})
+}
+
+func (f *FulcrumApiClient) ListParticipants() ([]model.ParticipantData, error) {
+	return listAll[model.ParticipantData](f, "/api/v1/participants")
+}
+
+func (f *FulcrumApiClient) ListServiceGroups() ([]model.ServiceGroupData, error) {
+	return listAll[model.ServiceGroupData](f, "/api/v1/service-groups")
+}
+
+func (f *FulcrumApiClient) ListAgents() ([]model.AgentData, error) {
+	return listAll[model.AgentData](f, "/api/v1/agents")
+}
+
+func (f *FulcrumApiClient) UpdateAgent(id string, agentData model.AgentData) error {
+	return f.patch("/api/v1/agents/"+id, map[string]interface{}{
+		"name":          agentData.Name,
+		"agentTypeId":   agentData.AgentTypeId,
+		"tags":          agentData.Tags,
+		"configuration": agentData.Configuration,
+	})
+}
+
+// listAll fetches all pages of a list
+func listAll[T any](f *FulcrumApiClient, path string) ([]T, error) {
+	var items []T
+	for page := 1; ; page++ {
+		rq, err := http.NewRequest("GET", fmt.Sprintf("%s%s?page=%d&pageSize=%d", f.BaseUrl, path, page, listPageSize), nil)
+		if err != nil {
+			return nil, err
+		}
+		body, err := f.requestWithResponse(rq)
+		if err != nil {
+			return nil, err
+		}
+		response := model.ListResponse[T]{}
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+		items = append(items, response.Items...)
+		if !response.HasNext {
+			return items, nil
+		}
+	}
+}
+
+func (f *FulcrumApiClient) patch(path string, fields map[string]interface{}) error {
+	body, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	rq, err := http.NewRequest("PATCH", f.BaseUrl+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	_, err = f.requestWithResponse(rq)
+	return err
+}
+
 func (f *FulcrumApiClient) RegenerateToken(tokenId string) (*model.TokenData, error) {
 	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/tokens/"+tokenId+"/regenerate", nil)
 	if err != nil {
@@ -224,6 +332,15 @@ func (f *FulcrumApiClient) RegenerateToken(tokenId string) (*model.TokenData, er
 	return &tokenData, nil
 }
 
+func (f *FulcrumApiClient) DeleteToken(tokenId string) error {
+	rq, err := http.NewRequest("DELETE", f.BaseUrl+"/api/v1/tokens/"+tokenId, nil)
+	if err != nil {
+		return err
+	}
+	_, err = f.requestWithResponse(rq)
+	return err
+}
+
 func (f *FulcrumApiClient) GetPendingJobs(agentToken string) ([]model.PendingJob, error) {
 	rq, err := http.NewRequest("GET", f.BaseUrl+"/api/v1/jobs/pending", nil)
 	if err != nil {
@@ -256,13 +373,12 @@ func (f *FulcrumApiClient) ClaimJob(agentToken string, jobId string) error {
 	return nil
 }
 
-func (f *FulcrumApiClient) FinalizeJob(agentToken string, jobId string) error {
-	body := `{
-		"externalId": "go-provisioner-%s",
-		"resources":{}
-	}`
-	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/jobs/"+jobId+"/complete", strings.NewReader(fmt.Sprintf(body, uuid.New().String())))
-
+func (f *FulcrumApiClient) FinalizeJob(agentToken string, jobId string, result model.JobResult) error {
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/jobs/"+jobId+"/complete", bytes.NewReader(body))
 	if err != nil {
 		return err
 	}
@@ -273,6 +389,21 @@ func (f *FulcrumApiClient) FinalizeJob(agentToken string, jobId string) error {
 	return nil
 }
 
+func (f *FulcrumApiClient) FailJob(agentToken string, jobId string, errorMessage string) error {
+	body, err := json.Marshal(map[string]string{
+		"errorMessage": errorMessage,
+	})
+	if err != nil {
+		return err
+	}
+	rq, err := http.NewRequest("POST", f.BaseUrl+"/api/v1/jobs/"+jobId+"/fail", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	_, err = f.requestWithResponseWithKey(rq, agentToken)
+	return err
+}
+
 func (f *FulcrumApiClient) requestWithResponseWithKey(rq *http.Request, apiKey string) ([]byte, error) {
 	rq.Header.Add("Authorization", "Bearer "+apiKey)
 
@@ -298,5 +429,9 @@ func (f *FulcrumApiClient) requestWithResponseWithKey(rq *http.Request, apiKey s
 }
 
 func (f *FulcrumApiClient) requestWithResponse(rq *http.Request) ([]byte, error) {
-	return f.requestWithResponseWithKey(rq, f.ApiKey)
+	token, err := f.AdminCredentials.Token()
+	if err != nil {
+		return nil, fmt.Errorf("admin credentials: %w", err)
+	}
+	return f.requestWithResponseWithKey(rq, token.AccessToken)
 }
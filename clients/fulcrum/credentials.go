@@ -0,0 +1,83 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+// StaticCredentials authenticate with a fixed admin API key
+func StaticCredentials(apiKey string) oauth2.TokenSource {
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: apiKey})
+}
+
+// FileCredentials authenticate with the admin API key stored in a file, e.g. a mounted Secret. The file is read for
+// every request, so that a rotated key is picked up without a restart.
+func FileCredentials(path string) oauth2.TokenSource {
+	return fileTokenSource{path: path}
+}
+
+type fileTokenSource struct {
+	path string
+}
+
+func (s fileTokenSource) Token() (*oauth2.Token, error) {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+	key := strings.TrimSpace(string(data))
+	if key == "" {
+		return nil, fmt.Errorf("%s is empty", s.path)
+	}
+	return &oauth2.Token{AccessToken: key}, nil
+}
+
+// ClientCredentials obtain access tokens from an identity provider with the OAuth2 client credentials grant. Tokens
+// are cached and obtained again shortly before they expire.
+func ClientCredentials(ctx context.Context, clientId string, clientSecret string, tokenUrl string, scopes []string) oauth2.TokenSource {
+	config := clientcredentials.Config{
+		ClientID:     clientId,
+		ClientSecret: clientSecret,
+		TokenURL:     tokenUrl,
+		Scopes:       scopes,
+	}
+	return config.TokenSource(ctx)
+}
+
+// DiscoverTokenUrl reads the token endpoint from the OpenID Connect discovery document of the issuer, e.g.
+// https://keycloak.example.com/realms/fulcrum
+func DiscoverTokenUrl(ctx context.Context, issuer string) (string, error) {
+	rq, err := http.NewRequestWithContext(ctx, "GET", strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.DefaultClient.Do(rq)
+	if err != nil {
+		return "", err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OpenID configuration of %s: unexpected status code %d", issuer, resp.StatusCode)
+	}
+
+	var configuration struct {
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&configuration); err != nil {
+		return "", fmt.Errorf("OpenID configuration of %s: %w", issuer, err)
+	}
+	if configuration.TokenEndpoint == "" {
+		return "", fmt.Errorf("OpenID configuration of %s has no token endpoint", issuer)
+	}
+	return configuration.TokenEndpoint, nil
+}
@@ -6,25 +6,38 @@ import (
 	"errors"
 	"fmt"
 	"k8s-provisioner/clients/fulcrum"
+	"k8s-provisioner/internal/api/v1alpha1"
+	"k8s-provisioner/internal/bootstrap"
+	"k8s-provisioner/internal/controller"
+	"k8s-provisioner/internal/jobs"
+	"k8s-provisioner/internal/kube"
 	"k8s-provisioner/internal/model"
 	"k8s-provisioner/internal/provisioner"
 	"k8s-provisioner/internal/seed"
 	"k8s-provisioner/internal/server"
+	"k8s-provisioner/internal/token"
+	"k8s-provisioner/internal/upgrade"
 	"log"
 	"os"
 	"os/signal"
-	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/gofiber/fiber/v2"
+	"golang.org/x/oauth2"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
 	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	_ "embed"
 )
@@ -32,11 +45,130 @@ import (
 type CLI struct {
 	KubeConfig  string `help:"Path to KubeConfig file" env:"KUBECONFIG" default:"~/.kube/config"`
 	FulcrumCore string `help:"Fulcrum Core API Host" env:"FULCRUM_CORE"`
+	Controller  bool   `help:"Reconcile Participant resources continuously, the REST API and Fulcrum jobs then manage Participant resources" env:"CONTROLLER"`
+
+	Admin AdminCredentials `embed:"" prefix:"fulcrum-" envprefix:"FULCRUM_" group:"Fulcrum Core admin credentials"`
+
+	LeaderElect             bool   `help:"Elect a leader among the replicas, only the leader processes Fulcrum jobs and reconciles Participants" env:"LEADER_ELECT"`
+	LeaderElectionNamespace string `help:"Namespace of the leader election Leases" env:"LEADER_ELECTION_NAMESPACE" default:"fulcrum-core"`
+	LeaderElectionId        string `help:"Name of the leader election Lease, the controller uses it with the suffix -controller" env:"LEADER_ELECTION_ID" default:"go-provisioner"`
+
+	Token             string        `help:"Agent token to use if it is still valid, instead of the persisted or a new one" env:"TOKEN"`
+	TokenSecret       string        `help:"Secret (namespace/name) in which the agent token is persisted, empty to not persist it" env:"TOKEN_SECRET" default:"fulcrum-core/provisioner-token"`
+	TokenLifetime     time.Duration `help:"How long newly issued agent tokens are valid" env:"TOKEN_LIFETIME" default:"8760h"`
+	TokenRotateBefore time.Duration `help:"How long before its expiry the agent token is replaced by a new one" env:"TOKEN_ROTATE_BEFORE" default:"168h"`
+
+	TemplateDir            string        `help:"Directory to load provisioning templates from, overrides the embedded ones" env:"TEMPLATE_DIR"`
+	TemplateConfigMap      string        `help:"ConfigMap (namespace/name) to load provisioning templates from, overrides the embedded ones" env:"TEMPLATE_CONFIGMAP"`
+	TemplateReloadInterval time.Duration `help:"Interval in which external templates are checked for changes" env:"TEMPLATE_RELOAD_INTERVAL" default:"30s"`
+
+	NamespaceDeletionTimeout time.Duration `help:"How long deletions wait for the participant namespace to finish terminating, 0 to not wait" env:"NAMESPACE_DELETION_TIMEOUT" default:"0s"`
+	ReadinessTimeout         time.Duration `help:"How long participant deployments may take to become ready, unless their profile specifies a timeout" env:"READINESS_TIMEOUT" default:"10m"`
+	HistoryLimit             int           `help:"Number of applied manifests kept per participant for rollbacks, 0 to disable" env:"HISTORY_LIMIT" default:"10"`
+
+	ReadinessResync           time.Duration `help:"Interval in which the readiness tracker re-lists all participant deployments" env:"READINESS_RESYNC" default:"10m"`
+	ReadinessFallbackInterval time.Duration `help:"Interval in which deployments are checked even without a change notification" env:"READINESS_FALLBACK_INTERVAL" default:"30s"`
+	IngressAddressGates       bool          `help:"Wait for the ingress controller to publish an address on every ingress, requires a controller that publishes ingress status" env:"INGRESS_ADDRESS_GATES"`
+
+	JobWorkers        int           `help:"Number of Fulcrum jobs processed concurrently" env:"JOB_WORKERS" default:"4"`
+	JobQueueSize      int           `help:"Number of claimed Fulcrum jobs that may wait for a worker" env:"JOB_QUEUE_SIZE" default:"8"`
+	JobTimeout        time.Duration `help:"How long a single Fulcrum job may take, including readiness and seeding" env:"JOB_TIMEOUT" default:"20m"`
+	PollInterval      time.Duration `help:"Interval in which Fulcrum Core is polled for pending jobs" env:"POLL_INTERVAL" default:"10s"`
+	PollJitter        time.Duration `help:"Maximum random deviation from the poll interval" env:"POLL_JITTER" default:"2s"`
+	PollMaxBackoff    time.Duration `help:"Maximum interval between polls after polls failed" env:"POLL_MAX_BACKOFF" default:"5m"`
+	WebhookSecret     string        `help:"Shared secret of signed job notifications, enables the notification endpoint" env:"WEBHOOK_SECRET"`
+	JobStateNamespace string        `help:"Namespace of the ConfigMaps that record the progress of claimed Fulcrum jobs" env:"JOB_STATE_NAMESPACE" default:"fulcrum-core"`
+
+	Postgres     ComponentDefaults `embed:"" prefix:"postgres-" envprefix:"POSTGRES_" group:"Postgres defaults"`
+	Vault        ComponentDefaults `embed:"" prefix:"vault-" envprefix:"VAULT_" group:"Vault defaults"`
+	ControlPlane ComponentDefaults `embed:"" prefix:"controlplane-" envprefix:"CONTROLPLANE_" group:"Control plane defaults"`
+	DataPlane    ComponentDefaults `embed:"" prefix:"dataplane-" envprefix:"DATAPLANE_" group:"Data plane defaults"`
+	IdentityHub  ComponentDefaults `embed:"" prefix:"identityhub-" envprefix:"IDENTITYHUB_" group:"IdentityHub defaults"`
+
+	Serve struct{} `cmd:"" default:"withargs" help:"Run the provisioner (default)"`
+	Plan  PlanCmd  `cmd:"" help:"Show the changes provisioning or deleting a participant would make, without applying them"`
+}
+
+// AdminCredentials configure how the provisioner authenticates to Fulcrum Core to bootstrap its entities and tokens.
+// OAuth2 client credentials take precedence over an API key.
+type AdminCredentials struct {
+	ApiKey           string   `help:"Admin API key" env:"API_KEY"`
+	ApiKeyFile       string   `help:"File containing the admin API key, e.g. a mounted Secret, overrides the API key" env:"API_KEY_FILE"`
+	ClientId         string   `help:"OAuth2 client id, enables the client credentials grant" env:"CLIENT_ID"`
+	ClientSecret     string   `help:"OAuth2 client secret" env:"CLIENT_SECRET"`
+	ClientSecretFile string   `help:"File containing the OAuth2 client secret, overrides the client secret" env:"CLIENT_SECRET_FILE"`
+	TokenUrl         string   `help:"Token endpoint of the identity provider" env:"TOKEN_URL"`
+	Issuer           string   `help:"OpenID Connect issuer to discover the token endpoint from, if no token endpoint is set" env:"ISSUER"`
+	Scopes           []string `help:"OAuth2 scopes to request" env:"SCOPES"`
+}
+
+// configured is true if any source of admin credentials is set
+func (c AdminCredentials) configured() bool {
+	return c.ApiKey != "" || c.ApiKeyFile != "" || c.ClientId != ""
+}
+
+func (c AdminCredentials) tokenSource(ctx context.Context) (oauth2.TokenSource, error) {
+	if c.ClientId == "" {
+		if c.ApiKeyFile != "" {
+			return clients.FileCredentials(c.ApiKeyFile), nil
+		}
+		return clients.StaticCredentials(c.ApiKey), nil
+	}
+
+	secret := c.ClientSecret
+	if c.ClientSecretFile != "" {
+		data, err := os.ReadFile(c.ClientSecretFile)
+		if err != nil {
+			return nil, fmt.Errorf("read client secret: %w", err)
+		}
+		secret = strings.TrimSpace(string(data))
+	}
+	tokenUrl := c.TokenUrl
+	if tokenUrl == "" {
+		if c.Issuer == "" {
+			return nil, errors.New("client credentials require a token endpoint or an issuer")
+		}
+		discovered, err := clients.DiscoverTokenUrl(ctx, c.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		tokenUrl = discovered
+	}
+	return clients.ClientCredentials(ctx, c.ClientId, secret, tokenUrl, c.Scopes), nil
+}
+
+// ComponentDefaults are the cluster-wide defaults of a single component, participants can override them individually
+type ComponentDefaults struct {
+	Image           string `help:"Container image" env:"IMAGE"`
+	ImagePullPolicy string `help:"Image pull policy (Always, IfNotPresent, Never)" env:"IMAGE_PULL_POLICY"`
+	Replicas        int32  `help:"Number of replicas" env:"REPLICAS"`
+	CpuRequest      string `help:"CPU request, e.g. 250m" env:"CPU_REQUEST"`
+	MemoryRequest   string `help:"Memory request, e.g. 256Mi" env:"MEMORY_REQUEST"`
+	CpuLimit        string `help:"CPU limit, e.g. 1" env:"CPU_LIMIT"`
+	MemoryLimit     string `help:"Memory limit, e.g. 1Gi" env:"MEMORY_LIMIT"`
+}
+
+func (d ComponentDefaults) overrides() model.ComponentOverrides {
+	overrides := model.ComponentOverrides{
+		Image:           d.Image,
+		ImagePullPolicy: d.ImagePullPolicy,
+		Resources: &model.ResourceRequirements{
+			Requests: model.ResourceList{Cpu: d.CpuRequest, Memory: d.MemoryRequest},
+			Limits:   model.ResourceList{Cpu: d.CpuLimit, Memory: d.MemoryLimit},
+		},
+	}
+	if d.Replicas > 0 {
+		overrides.Replicas = &d.Replicas
+	}
+	return overrides
 }
 
 func main() {
 	var cli CLI
-	kong.Parse(&cli)
+	command := kong.Parse(&cli)
+	if cli.FulcrumCore != "" && !strings.HasPrefix(command.Command(), "plan") && !cli.Admin.configured() {
+		command.Fatalf("Fulcrum Core admin credentials are required, set an API key, an API key file or an OAuth2 client id")
+	}
 
 	// Create context with cancellation
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
@@ -72,48 +204,119 @@ func main() {
 	scheme := runtime.NewScheme()
 	_ = appsv1.AddToScheme(scheme)
 	_ = corev1.AddToScheme(scheme)
+	_ = discoveryv1.AddToScheme(scheme)
 	_ = networkingv1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
 
 	kubeClient, err := client.New(konfig, client.Options{Scheme: scheme})
 	if err != nil {
 		log.Fatalf("create client: %v", err)
 	}
-	provisioningAgent := provisioner.NewProvisioningAgent(ctx, kubeClient)
+	defaults, err := provisioner.DefaultTemplateValues().WithOverrides(map[string]model.ComponentOverrides{
+		provisioner.ComponentPostgres:     cli.Postgres.overrides(),
+		provisioner.ComponentVault:        cli.Vault.overrides(),
+		provisioner.ComponentControlPlane: cli.ControlPlane.overrides(),
+		provisioner.ComponentDataPlane:    cli.DataPlane.overrides(),
+		provisioner.ComponentIdentityHub:  cli.IdentityHub.overrides(),
+	})
+	if err != nil {
+		log.Fatalf("invalid component defaults: %v", err)
+	}
+	templates, err := templateSource(ctx, cli, kubeClient)
+	if err != nil {
+		log.Fatalf("create template source: %v", err)
+	}
+	// waits for deployment readiness are driven by a shared informer, except for plans which never wait
+	var tracker *kube.ReadinessTracker
+	if !strings.HasPrefix(command.Command(), "plan") {
+		tracker, err = kube.NewReadinessTracker(konfig, scheme, labels.SelectorFromSet(labels.Set{provisioner.LabelManagedBy: provisioner.ManagedBy}), cli.ReadinessResync, cli.ReadinessFallbackInterval)
+		if err != nil {
+			log.Fatalf("create readiness tracker: %v", err)
+		}
+		if err := tracker.Start(ctx); err != nil {
+			log.Fatalf("start readiness tracker: %v", err)
+		}
+	}
+	provisioningAgent := provisioner.NewProvisioningAgent(ctx, kubeClient, provisioner.Config{
+		Defaults:                 defaults,
+		Templates:                templates,
+		NamespaceDeletionTimeout: cli.NamespaceDeletionTimeout,
+		ReadinessTimeout:         cli.ReadinessTimeout,
+		HistoryLimit:             cli.HistoryLimit,
+		ReadinessTracker:         tracker,
+		IngressAddressGates:      cli.IngressAddressGates,
+	})
 
-	// Start periodic health check
-	if cli.FulcrumCore == "" {
-		log.Printf("No Fulcrum Core API endpoint was supplied, will skip periodic checking")
-	} else {
-		apiClient := clients.NewFulcrumApiClient(cli.FulcrumCore)
-		token, seedError := seedFulcrumCore(apiClient)
-		if seedError != nil {
-			log.Fatalf("Error seeding Fulcrum Core: %s", seedError)
+	if strings.HasPrefix(command.Command(), "plan") {
+		command.FatalIfErrorf(cli.Plan.run(provisioningAgent))
+		return
+	}
+
+	// upgrades always apply directly, the Participant resources of the controller mode do not change during an upgrade
+	upgrader := upgrade.NewUpgrader(ctx, kubeClient, provisioningAgent)
+
+	onReady := onDeploymentReady
+	if cli.Controller {
+		provisioningAgent, err = startController(ctx, cli, konfig, scheme, kubeClient, provisioningAgent)
+		if err != nil {
+			log.Fatalf("start controller: %v", err)
 		}
-		if token == nil {
-			log.Fatalf("Error seeding/fetching fulcrum token: token is nil")
+		// the controller seeds the data before it reports the participant as ready
+		onReady = func(definition model.ParticipantDefinition) error {
+			log.Println("Participant", definition.ParticipantName, "is ready")
+			return nil
 		}
+	}
+	rollbacks := upgrade.NewRollbacks(provisioningAgent)
 
-		go func() {
-			ticker := time.NewTicker(10 * time.Second)
-			defer ticker.Stop()
+	// notifications reach any replica, those that do not reach the leader are picked up by its next regular poll
+	var webhook *jobs.WebhookSource
+	if cli.WebhookSecret != "" {
+		webhook = jobs.NewWebhookSource(cli.WebhookSecret)
+	}
 
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					pollFulcrum(apiClient, *token, provisioningAgent)
-				}
-			}
-		}()
-		log.Println("Start polling Fulcrum Core at " + cli.FulcrumCore)
+	// only the leader bootstraps Fulcrum Core, processes jobs and runs upgrades and rollbacks, all replicas serve the
+	// remaining REST API. Without leader election every replica leads.
+	// counts the leadership terms in progress, the previous term may not have ended yet when the next one begins
+	var terms atomic.Int32
+	isLeader := func() bool {
+		return terms.Load() > 0
+	}
+	lead := func(ctx context.Context) {
+		terms.Add(1)
+		if cli.FulcrumCore == "" {
+			log.Printf("No Fulcrum Core API endpoint was supplied, will skip periodic checking")
+		} else {
+			go startFulcrum(ctx, cli, kubeClient, provisioningAgent, onReady, webhook)
+		}
+		<-ctx.Done()
+		terms.Add(-1)
+	}
+	if cli.LeaderElect {
+		if err := kube.RunAsLeader(ctx, konfig, cli.LeaderElectionNamespace, cli.LeaderElectionId, lead); err != nil {
+			log.Fatalf("start leader election: %v", err)
+		}
+	} else {
+		go lead(ctx)
 	}
 
 	app := fiber.New()
 	{
 		group := app.Group("/api/v1/resources")
-		group.Post("/", server.CreateResource(provisioningAgent, onDeploymentReady))
+		group.Post("/", server.CreateResource(provisioningAgent, onReady))
 		group.Delete("/", server.DeleteResource(provisioningAgent))
+		group.Post("/plan", server.PlanResource(provisioningAgent))
+		group.Get("/:name/history", server.GetHistory(provisioningAgent))
+		group.Post("/:name/rollback", server.RequireLeader(isLeader), server.RollbackResource(rollbacks))
+		group.Get("/:name/rollback", server.RequireLeader(isLeader), server.GetRollback(rollbacks))
+	}
+	{
+		group := app.Group("/api/v1/upgrades", server.RequireLeader(isLeader))
+		group.Post("/", server.StartUpgrade(upgrader))
+		group.Get("/", server.GetUpgrade(upgrader))
+	}
+	if webhook != nil {
+		app.Post("/api/v1/jobs/notify", server.NotifyJobs(webhook))
 	}
 	// Run server and shut down gracefully on ctx cancel
 	go func() {
@@ -126,151 +329,173 @@ func main() {
 	_ = app.Shutdown()
 }
 
-func pollFulcrum(apiClient clients.FulcrumApi, agentToken string, agent provisioner.ProvisioningAgent) {
-
-	jobs, err := apiClient.GetPendingJobs(agentToken)
-	if err != nil {
-		log.Printf("Error getting pending jobs: %s\n", err)
-		return
-	}
-	if len(jobs) > 0 {
-		log.Println("Got " + strconv.Itoa(len(jobs)) + " pending jobs")
-	}
-
-	for _, job := range jobs {
-		if job.Status == "Pending" {
-			def := model.ParticipantDefinition{
-				ParticipantName:       fmt.Sprintf("%v", job.Service.Properties["participantName"]),
-				Did:                   fmt.Sprintf("%v", job.Service.Properties["participantDid"]),
-				KubernetesIngressHost: fmt.Sprintf("%v", job.Service.Properties["kubeHost"]),
-			}
-			e := apiClient.ClaimJob(agentToken, job.Id)
-			log.Printf("Claimed job %s (\"%s\"), Action = %s\n", job.Id, job.Service.Name, job.Action)
-			if e != nil {
-				log.Printf("Error claiming job: %s", e)
-			}
-
-			if job.Action == "Create" {
-				_, provisioningError := agent.CreateResources(def, func(definition model.ParticipantDefinition) {
-					onDeploymentReady(definition)
-					e = apiClient.FinalizeJob(agentToken, job.Id)
-					if e != nil {
-						log.Printf("Error finalizing job: %s\n", e)
-					} else {
-						log.Printf("Finalized job: %s\n", job.Id)
-					}
-				})
-				if provisioningError != nil {
-					log.Printf("Error creating resources: %s\n", provisioningError)
-					return
-				}
-			} else if job.Action == "Delete" {
-				_, provisioningErr := agent.DeleteResources(def)
-				if provisioningErr != nil {
-					log.Printf("Error creating resources: %s\n", provisioningErr)
-					return
-				} else {
-					log.Println("Resource deletion complete.")
-					e = apiClient.FinalizeJob(agentToken, job.Id)
-					if e != nil {
-						log.Printf("Error finalizing job: %s\n", e)
-					} else {
-						log.Printf("Finalized job: %s\n", job.Id)
-					}
-				}
-			}
-
-		} else {
-			log.Printf("Pending Job in status %s", job.Status)
+// templateSource selects where templates are loaded from, the embedded templates are used for everything that is not
+// provided externally
+func templateSource(ctx context.Context, cli CLI, kubeClient client.Client) (provisioner.TemplateSource, error) {
+	embedded := provisioner.NewEmbeddedTemplateSource()
+	var source *provisioner.ReloadingTemplateSource
+	switch {
+	case cli.TemplateDir != "" && cli.TemplateConfigMap != "":
+		return nil, errors.New("only one of --template-dir and --template-config-map can be set")
+	case cli.TemplateDir != "":
+		source = provisioner.NewDirectoryTemplateSource(cli.TemplateDir, embedded, cli.TemplateReloadInterval)
+	case cli.TemplateConfigMap != "":
+		namespace, name, found := strings.Cut(cli.TemplateConfigMap, "/")
+		if !found {
+			return nil, fmt.Errorf("template config map must be given as namespace/name, got %q", cli.TemplateConfigMap)
 		}
+		source = provisioner.NewConfigMapTemplateSource(kubeClient, namespace, name, embedded, cli.TemplateReloadInterval)
+	default:
+		return embedded, nil
+	}
+	if err := source.Start(ctx); err != nil {
+		return nil, err
 	}
+	return source, nil
 }
 
-func onDeploymentReady(definition model.ParticipantDefinition) {
-	log.Println("Deployments ready in namespace", definition.ParticipantName, "-> creating data")
-
-	seed.ConnectorData(definition)
-	seed.IdentityHubData(definition)
-	seed.IssuerData(definition)
-
-	log.Println("Data seeding complete in namespace", definition.ParticipantName)
+// todo: make configurable
+const (
+	fulcrumRetryInterval    = 10 * time.Second
+	fulcrumMaxRetryInterval = 5 * time.Minute
+)
 
+// startFulcrum runs runFulcrum until it succeeds, backing off exponentially while Fulcrum Core is not reachable
+func startFulcrum(ctx context.Context, cli CLI, kubeClient client.Client, provisioningAgent provisioner.ProvisioningAgent, onReady func(model.ParticipantDefinition) error, webhook *jobs.WebhookSource) {
+	wait := fulcrumRetryInterval
+	for {
+		err := runFulcrum(ctx, cli, kubeClient, provisioningAgent, onReady, webhook)
+		if err == nil {
+			return
+		}
+		log.Printf("Error starting to process Fulcrum jobs, retrying in %s: %v\n", wait, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, fulcrumMaxRetryInterval)
+	}
 }
 
-func seedFulcrumCore(apiClient clients.FulcrumApi) (*string, error) {
-
-	log.Println("### Seeding Fulcrum Core ###")
-	// see if a token already exists, if so, get its value and return
-	const tokenName = "Provisioner Access Token"
-	tokens, err := apiClient.ListTokens()
+// runFulcrum bootstraps Fulcrum Core and processes its jobs in the background until the context is done. Jobs that are
+// in flight then are resumed by the next run, possibly on another replica. The optional webhook triggers polls in
+// addition to the regular ones. Nothing is started in the background if it fails.
+func runFulcrum(ctx context.Context, cli CLI, kubeClient client.Client, provisioningAgent provisioner.ProvisioningAgent, onReady func(model.ParticipantDefinition) error, webhook *jobs.WebhookSource) error {
+	adminCredentials, err := cli.Admin.tokenSource(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list tokens: %w", err)
-	}
-	for _, token := range tokens {
-		if token.Name == tokenName {
-			tokenData, e := apiClient.RegenerateToken(token.Id)
-			if e != nil {
-				return nil, fmt.Errorf("failed to get token data: %w", e)
-			}
-			log.Println("  agent already exists, aborting.")
-			return &tokenData.Value, nil
-		}
+		return fmt.Errorf("Fulcrum Core admin credentials: %w", err)
 	}
-
-	// seed service type
-	log.Println("  > creating service type")
-
-	serviceTypeId, err := apiClient.CreateServiceType("edc-aio", "EDC All-in-one deployment")
+	apiClient := clients.NewFulcrumApiClient(cli.FulcrumCore, adminCredentials)
+	entities, err := bootstrap.Reconcile(apiClient)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create service type: %w", err)
+		return fmt.Errorf("seed Fulcrum Core: %w", err)
 	}
-
-	//create agent-type
-	log.Println("  > creating agent type")
-	agentTypeId, err := apiClient.CreateAgentType(serviceTypeId, "go-provisioner-agent")
+	tokens, err := tokenManager(cli, apiClient, kubeClient)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create agent type: %w", err)
+		return fmt.Errorf("create token manager: %w", err)
+	}
+	if err := tokens.Init(ctx, entities.AgentId, cli.Token); err != nil {
+		return fmt.Errorf("fetch agent token: %w", err)
 	}
 
-	// create participant
-	log.Println("  > creating participant")
-	participantId, err := apiClient.CreateParticipant("K8S Provisioner Participant")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create participant: %w", err)
+	processor := &jobs.Processor{
+		Agent:               provisioningAgent,
+		Seeder:              onReady,
+		KubeClient:          kubeClient,
+		ServiceTypeProfiles: entities.ServiceTypeProfiles,
+	}
+	store := jobs.NewConfigMapStore(ctx, kubeClient, cli.JobStateNamespace)
+	dispatcher := jobs.NewDispatcher(ctx, apiClient, tokens.Token, store, processor.Handle, jobs.Options{
+		Workers:    cli.JobWorkers,
+		QueueSize:  cli.JobQueueSize,
+		JobTimeout: cli.JobTimeout,
+	})
+	if err := dispatcher.Resume(); err != nil {
+		return fmt.Errorf("resume claimed jobs: %w", err)
+	}
+	tokens.Start(ctx)
+	sources := []jobs.Source{jobs.PollingSource{
+		Interval:   cli.PollInterval,
+		Jitter:     cli.PollJitter,
+		MaxBackoff: cli.PollMaxBackoff,
+	}}
+	if webhook != nil {
+		sources = append(sources, webhook)
 	}
+	dispatcher.Start(sources...)
+	log.Println("Start polling Fulcrum Core at " + cli.FulcrumCore)
+	return nil
+}
 
-	// create service-group
-	log.Println("  > creating service group")
-	serviceGroupId, err := apiClient.CreateServiceGroup(participantId, "EDC Services Group")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create service group: %w", err)
-	}
-	log.Println("Created service group", serviceGroupId)
-
-	// create agent
-	log.Println("  > creating agent")
-	agentId, err := apiClient.CreateAgent(model.AgentData{
-		Name:          tokenName,
-		ProviderId:    participantId,
-		AgentTypeId:   agentTypeId,
-		Tags:          []string{"cfm", "edc"},
-		Configuration: make(map[string]interface{}),
+// tokenManager creates the manager of the agent token, which persists the token in the Secret given as namespace/name
+func tokenManager(cli CLI, apiClient clients.FulcrumApi, kubeClient client.Client) (*token.Manager, error) {
+	var secret client.ObjectKey
+	if cli.TokenSecret != "" {
+		namespace, name, found := strings.Cut(cli.TokenSecret, "/")
+		if !found {
+			return nil, fmt.Errorf("token secret must be given as namespace/name, got %q", cli.TokenSecret)
+		}
+		secret = client.ObjectKey{Namespace: namespace, Name: name}
+	}
+	return token.NewManager(apiClient, kubeClient, secret, bootstrap.AgentName, token.Options{
+		Lifetime:     cli.TokenLifetime,
+		RotateBefore: cli.TokenRotateBefore,
+	})
+}
+
+// startController runs the Participant reconciler in the background and returns an agent that provisions participants
+// by managing their Participant resources
+func startController(ctx context.Context, cli CLI, konfig *rest.Config, scheme *runtime.Scheme, kubeClient client.Client, agent provisioner.ProvisioningAgent) (provisioner.ProvisioningAgent, error) {
+	mgr, err := ctrl.NewManager(konfig, ctrl.Options{
+		Scheme:                        scheme,
+		Metrics:                       metricsserver.Options{BindAddress: "0"},
+		LeaderElection:                cli.LeaderElect,
+		LeaderElectionNamespace:       cli.LeaderElectionNamespace,
+		LeaderElectionID:              cli.LeaderElectionId + "-controller",
+		LeaderElectionReleaseOnCancel: true,
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create agent: %w", err)
+		return nil, err
 	}
+	reconciler := &controller.ParticipantReconciler{
+		Client: mgr.GetClient(),
+		Agent:  agent,
+		Seeder: onDeploymentReady,
+	}
+	if err := reconciler.SetupWithManager(mgr); err != nil {
+		return nil, err
+	}
+	go func() {
+		if err := mgr.Start(ctx); err != nil {
+			log.Fatalf("controller manager: %v", err)
+		}
+	}()
+	log.Println("Started Participant controller")
+	return controller.NewParticipantAgent(ctx, kubeClient, agent, cli.ReadinessTimeout), nil
+}
 
-	// create agent token
-	log.Println("  > creating agent token")
-	token, err := apiClient.CreateAgentToken(agentId, tokenName)
+func onDeploymentReady(definition model.ParticipantDefinition) error {
+	log.Println("Deployments ready in namespace", definition.ParticipantName, "-> creating data")
+
+	profile, err := provisioner.LookupProfile(definition.Profile)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create agent token: %w", err)
+		return err
+	}
+	if profile.Includes(provisioner.ComponentControlPlane) {
+		if err := seed.ConnectorData(definition); err != nil {
+			return err
+		}
+	}
+	if profile.Includes(provisioner.ComponentIdentityHub) {
+		if err := seed.IdentityHubData(definition); err != nil {
+			return err
+		}
+		if err := seed.IssuerData(definition); err != nil {
+			return err
+		}
 	}
 
-	// log information
-	log.Println("Created agent ID=", agentId)
-	log.Println("Created service type ID=", serviceTypeId)
-	log.Println("Created service group ID=", serviceGroupId)
-
-	return &token, nil
+	log.Println("Data seeding complete in namespace", definition.ParticipantName)
+	return nil
 }
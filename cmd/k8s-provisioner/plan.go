@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/provisioner"
+	"os"
+)
+
+// PlanCmd shows what provisioning or deleting a participant would change in the cluster, without changing anything
+type PlanCmd struct {
+	ParticipantName string `arg:"" optional:"" help:"Name of the participant"`
+	Did             string `help:"DID of the participant"`
+	KubeHost        string `help:"Ingress host of the cluster" default:"localhost"`
+	Profile         string `help:"Service profile of the participant"`
+	Definition      string `help:"JSON file containing the participant definition, replaces the other participant flags" type:"existingfile"`
+	Delete          bool   `help:"Plan the deletion of the participant instead of its creation"`
+}
+
+func (p PlanCmd) run(agent provisioner.ProvisioningAgent) error {
+	definition, err := p.participantDefinition()
+	if err != nil {
+		return err
+	}
+
+	var changes []model.ObjectChange
+	if p.Delete {
+		changes, err = agent.PlanDeleteResources(definition)
+	} else {
+		changes, err = agent.PlanCreateResources(definition)
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		fmt.Printf("%-9s %s %s/%s\n", change.Operation, change.Kind, change.Namespace, change.Name)
+		if change.Diff != "" {
+			fmt.Println(change.Diff)
+		}
+	}
+	return nil
+}
+
+func (p PlanCmd) participantDefinition() (model.ParticipantDefinition, error) {
+	definition := model.ParticipantDefinition{
+		ParticipantName:       p.ParticipantName,
+		Did:                   p.Did,
+		KubernetesIngressHost: p.KubeHost,
+		Profile:               p.Profile,
+	}
+	if p.Definition != "" {
+		content, err := os.ReadFile(p.Definition)
+		if err != nil {
+			return definition, err
+		}
+		if err := json.Unmarshal(content, &definition); err != nil {
+			return definition, fmt.Errorf("parse participant definition: %w", err)
+		}
+	}
+	if definition.ParticipantName == "" || definition.Did == "" {
+		return definition, errors.New("a participant name and DID are required")
+	}
+	return definition, nil
+}
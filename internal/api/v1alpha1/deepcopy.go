@@ -0,0 +1,83 @@
+package v1alpha1
+
+import (
+	"k8s-provisioner/internal/model"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func (in *Participant) DeepCopyInto(out *Participant) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+func (in *Participant) DeepCopy() *Participant {
+	if in == nil {
+		return nil
+	}
+	out := new(Participant)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *Participant) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
+
+func (in *ParticipantSpec) DeepCopyInto(out *ParticipantSpec) {
+	*out = *in
+	if in.Components != nil {
+		out.Components = make(map[string]model.ComponentOverrides, len(in.Components))
+		for name, overrides := range in.Components {
+			if overrides.Replicas != nil {
+				replicas := *overrides.Replicas
+				overrides.Replicas = &replicas
+			}
+			if overrides.Resources != nil {
+				resources := *overrides.Resources
+				overrides.Resources = &resources
+			}
+			out.Components[name] = overrides
+		}
+	}
+}
+
+func (in *ParticipantStatus) DeepCopyInto(out *ParticipantStatus) {
+	*out = *in
+	if in.AppliedObjects != nil {
+		out.AppliedObjects = make([]AppliedObject, len(in.AppliedObjects))
+		copy(out.AppliedObjects, in.AppliedObjects)
+	}
+	if in.ReadyDeployments != nil {
+		out.ReadyDeployments = make([]string, len(in.ReadyDeployments))
+		copy(out.ReadyDeployments, in.ReadyDeployments)
+	}
+}
+
+func (in *ParticipantList) DeepCopyInto(out *ParticipantList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		out.Items = make([]Participant, len(in.Items))
+		for i := range in.Items {
+			in.Items[i].DeepCopyInto(&out.Items[i])
+		}
+	}
+}
+
+func (in *ParticipantList) DeepCopy() *ParticipantList {
+	if in == nil {
+		return nil
+	}
+	out := new(ParticipantList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+func (in *ParticipantList) DeepCopyObject() runtime.Object {
+	return in.DeepCopy()
+}
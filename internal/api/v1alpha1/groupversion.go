@@ -0,0 +1,19 @@
+// Package v1alpha1 contains the Participant custom resource, which records the desired and actual provisioning state of
+// a participant
+package v1alpha1
+
+import (
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/scheme"
+)
+
+var (
+	// GroupVersion is the group and version of all resources in this package
+	GroupVersion = schema.GroupVersion{Group: "provisioner.fulcrum.io", Version: "v1alpha1"}
+
+	// SchemeBuilder registers the resources of this package with a scheme
+	SchemeBuilder = &scheme.Builder{GroupVersion: GroupVersion}
+
+	// AddToScheme adds the resources of this package to a scheme
+	AddToScheme = SchemeBuilder.AddToScheme
+)
@@ -0,0 +1,93 @@
+package v1alpha1
+
+import (
+	"k8s-provisioner/internal/model"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// phases a Participant goes through, in this order
+const (
+	PhasePending = "Pending"
+	PhaseApplied = "Applied"
+	PhaseReady   = "Ready"
+	PhaseSeeded  = "Seeded"
+	// PhaseStopped replaces Applied, Ready and Seeded while the workloads of the participant are scaled to zero
+	PhaseStopped  = "Stopped"
+	PhaseFailed   = "Failed"
+	PhaseDeleting = "Deleting"
+)
+
+// Participant is a provisioned participant. Its name is the name of the participant and of its namespace.
+type Participant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ParticipantSpec   `json:"spec,omitempty"`
+	Status ParticipantStatus `json:"status,omitempty"`
+}
+
+// ParticipantSpec mirrors model.ParticipantDefinition, except for the participant name which is taken from the
+// object name
+type ParticipantSpec struct {
+	Did                   string                              `json:"did"`
+	KubernetesIngressHost string                              `json:"kubeHost,omitempty"`
+	Profile               string                              `json:"profile,omitempty"`
+	Components            map[string]model.ComponentOverrides `json:"components,omitempty"`
+	Stopped               bool                                `json:"stopped,omitempty"`
+}
+
+type ParticipantStatus struct {
+	Phase   string `json:"phase,omitempty"`
+	Message string `json:"message,omitempty"`
+	// Reason is the machine-readable cause of the Failed phase if the deployments did not become ready, e.g. "ImagePullBackOff"
+	Reason string `json:"reason,omitempty"`
+	// ObservedGeneration is the generation of the spec that was last reconciled
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// AppliedGeneration is the generation of the spec whose resources were last applied successfully
+	AppliedGeneration int64 `json:"appliedGeneration,omitempty"`
+	// SeededGeneration is the generation of the spec for which data was last seeded
+	SeededGeneration int64           `json:"seededGeneration,omitempty"`
+	AppliedObjects   []AppliedObject `json:"appliedObjects,omitempty"`
+	ReadyDeployments []string        `json:"readyDeployments,omitempty"`
+}
+
+type AppliedObject struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Generation of the object when it was applied, a different one means that someone else changed its spec
+	Generation int64 `json:"generation,omitempty"`
+}
+
+type ParticipantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Participant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Participant{}, &ParticipantList{})
+}
+
+// Definition converts the participant into the definition the provisioning agent works with
+func (p *Participant) Definition() model.ParticipantDefinition {
+	return model.ParticipantDefinition{
+		ParticipantName:       p.Name,
+		Did:                   p.Spec.Did,
+		KubernetesIngressHost: p.Spec.KubernetesIngressHost,
+		Profile:               p.Spec.Profile,
+		Components:            p.Spec.Components,
+		Stopped:               p.Spec.Stopped,
+	}
+}
+
+// SpecFromDefinition converts a participant definition into a Participant spec
+func SpecFromDefinition(definition model.ParticipantDefinition) ParticipantSpec {
+	return ParticipantSpec{
+		Did:                   definition.Did,
+		KubernetesIngressHost: definition.KubernetesIngressHost,
+		Profile:               definition.Profile,
+		Components:            definition.Components,
+		Stopped:               definition.Stopped,
+	}
+}
@@ -0,0 +1,243 @@
+package bootstrap
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s-provisioner/clients/fulcrum"
+	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/provisioner"
+	"log"
+	"slices"
+)
+
+// names of the entities the provisioner registers in Fulcrum Core, they identify the entities when seeding again
+const (
+	AgentName        = "Provisioner Access Token"
+	agentTypeName    = "go-provisioner-agent"
+	participantName  = "K8S Provisioner Participant"
+	serviceGroupName = "EDC Services Group"
+)
+
+var agentTags = []string{"cfm", "edc"}
+
+// Entities are the ids of the entities the provisioner registered in Fulcrum Core
+type Entities struct {
+	ServiceTypeIds []string
+	// ServiceTypeProfiles maps the id of each service type to the profile it provisions
+	ServiceTypeProfiles map[string]string
+	AgentTypeId         string
+	ParticipantId       string
+	ServiceGroupId      string
+	AgentId             string
+}
+
+// Reconcile looks up every entity the provisioner needs in Fulcrum Core by its name, creates the missing ones and
+// updates those that have drifted. Running it again without changes to the provisioner changes nothing.
+func Reconcile(apiClient clients.FulcrumApi) (*Entities, error) {
+	log.Println("### Seeding Fulcrum Core ###")
+	entities := &Entities{}
+	var err error
+
+	if entities.ServiceTypeIds, entities.ServiceTypeProfiles, err = serviceTypes(apiClient); err != nil {
+		return nil, err
+	}
+	if entities.AgentTypeId, err = agentType(apiClient, entities.ServiceTypeIds); err != nil {
+		return nil, err
+	}
+	if entities.ParticipantId, err = participant(apiClient); err != nil {
+		return nil, err
+	}
+	if entities.ServiceGroupId, err = serviceGroup(apiClient, entities.ParticipantId); err != nil {
+		return nil, err
+	}
+	if entities.AgentId, err = agent(apiClient, entities.ParticipantId, entities.AgentTypeId, model.AgentConfiguration{Profiles: provisioner.ProfileNames()}); err != nil {
+		return nil, err
+	}
+
+	log.Println("Agent ID=", entities.AgentId)
+	log.Println("Service type IDs=", entities.ServiceTypeIds)
+	log.Println("Service group ID=", entities.ServiceGroupId)
+	return entities, nil
+}
+
+// serviceTypes reconciles a service type for each profile, named after the profile, and returns their ids along with
+// the profile of each id. Their property schema describes what the job processing validates.
+func serviceTypes(apiClient clients.FulcrumApi) ([]string, map[string]string, error) {
+	existing, err := apiClient.ListServiceTypes()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list service types: %w", err)
+	}
+	schema := model.Schema(model.ServiceProperties{})
+	var ids []string
+	profiles := map[string]string{}
+	for _, profile := range provisioner.Profiles() {
+		index := slices.IndexFunc(existing, func(serviceType model.ServiceTypeData) bool {
+			return serviceType.Id == profile.Name || serviceType.Name == profile.Name
+		})
+		if index < 0 {
+			// earlier versions named the service types after the profile description, they are renamed below
+			index = slices.IndexFunc(existing, func(serviceType model.ServiceTypeData) bool {
+				return serviceType.Name == profile.Description
+			})
+		}
+		if index < 0 {
+			log.Println("  > creating service type", profile.Name)
+			id, err := apiClient.CreateServiceType(profile.Name, profile.Name, schema)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to create service type %s: %w", profile.Name, err)
+			}
+			ids = append(ids, id)
+			profiles[id] = profile.Name
+			continue
+		}
+		serviceType := existing[index]
+		if serviceType.Name != profile.Name || !equalJson(serviceType.PropertySchema, schema) {
+			log.Println("  > updating service type", profile.Name)
+			if err := apiClient.UpdateServiceType(serviceType.Id, profile.Name, schema); err != nil {
+				return nil, nil, fmt.Errorf("failed to update service type %s: %w", profile.Name, err)
+			}
+		}
+		ids = append(ids, serviceType.Id)
+		profiles[serviceType.Id] = profile.Name
+	}
+	return ids, profiles, nil
+}
+
+func agentType(apiClient clients.FulcrumApi, serviceTypeIds []string) (string, error) {
+	existing, err := apiClient.ListAgentTypes()
+	if err != nil {
+		return "", fmt.Errorf("failed to list agent types: %w", err)
+	}
+	schema := model.Schema(model.AgentConfiguration{})
+	index := slices.IndexFunc(existing, func(agentType model.AgentTypeData) bool {
+		return agentType.Name == agentTypeName
+	})
+	if index < 0 {
+		log.Println("  > creating agent type")
+		id, err := apiClient.CreateAgentType(serviceTypeIds, agentTypeName, schema)
+		if err != nil {
+			return "", fmt.Errorf("failed to create agent type: %w", err)
+		}
+		return id, nil
+	}
+
+	agentType := existing[index]
+	var currentIds []string
+	for _, serviceType := range agentType.ServiceTypes {
+		currentIds = append(currentIds, serviceType.Id)
+	}
+	if !sameElements(currentIds, serviceTypeIds) || !equalJson(agentType.ConfigurationSchema, schema) {
+		log.Println("  > updating agent type")
+		if err := apiClient.UpdateAgentType(agentType.Id, serviceTypeIds, agentTypeName, schema); err != nil {
+			return "", fmt.Errorf("failed to update agent type: %w", err)
+		}
+	}
+	return agentType.Id, nil
+}
+
+func participant(apiClient clients.FulcrumApi) (string, error) {
+	existing, err := apiClient.ListParticipants()
+	if err != nil {
+		return "", fmt.Errorf("failed to list participants: %w", err)
+	}
+	for _, participant := range existing {
+		if participant.Name == participantName {
+			return participant.Id, nil
+		}
+	}
+	log.Println("  > creating participant")
+	id, err := apiClient.CreateParticipant(participantName)
+	if err != nil {
+		return "", fmt.Errorf("failed to create participant: %w", err)
+	}
+	return id, nil
+}
+
+func serviceGroup(apiClient clients.FulcrumApi, participantId string) (string, error) {
+	existing, err := apiClient.ListServiceGroups()
+	if err != nil {
+		return "", fmt.Errorf("failed to list service groups: %w", err)
+	}
+	for _, group := range existing {
+		if group.Name == serviceGroupName && group.ConsumerId == participantId {
+			return group.Id, nil
+		}
+	}
+	log.Println("  > creating service group")
+	id, err := apiClient.CreateServiceGroup(participantId, serviceGroupName)
+	if err != nil {
+		return "", fmt.Errorf("failed to create service group: %w", err)
+	}
+	return id, nil
+}
+
+func agent(apiClient clients.FulcrumApi, participantId string, agentTypeId string, configuration model.AgentConfiguration) (string, error) {
+	values, err := agentConfiguration(configuration)
+	if err != nil {
+		return "", err
+	}
+	desired := model.AgentData{
+		Name:          AgentName,
+		ProviderId:    participantId,
+		AgentTypeId:   agentTypeId,
+		Tags:          agentTags,
+		Configuration: values,
+	}
+
+	existing, err := apiClient.ListAgents()
+	if err != nil {
+		return "", fmt.Errorf("failed to list agents: %w", err)
+	}
+	index := slices.IndexFunc(existing, func(agent model.AgentData) bool {
+		return agent.Name == AgentName && agent.ProviderId == participantId
+	})
+	if index < 0 {
+		log.Println("  > creating agent")
+		id, err := apiClient.CreateAgent(desired)
+		if err != nil {
+			return "", fmt.Errorf("failed to create agent: %w", err)
+		}
+		return id, nil
+	}
+
+	agent := existing[index]
+	if agent.AgentTypeId != agentTypeId || !sameElements(agent.Tags, agentTags) || !equalJson(agent.Configuration, values) {
+		log.Println("  > updating agent")
+		if err := apiClient.UpdateAgent(agent.Id, desired); err != nil {
+			return "", fmt.Errorf("failed to update agent: %w", err)
+		}
+	}
+	return agent.Id, nil
+}
+
+// agentConfiguration converts the configuration into the untyped form of the agent data, after checking it against
+// the schema that was registered for the agent type
+func agentConfiguration(configuration model.AgentConfiguration) (map[string]interface{}, error) {
+	if err := model.Validate(configuration); err != nil {
+		return nil, fmt.Errorf("agent configuration: %w", err)
+	}
+	data, err := json.Marshal(configuration)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]interface{}
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// equalJson compares two values by their JSON encoding, which ignores the difference between e.g. the integers of a
+// generated schema and the floats of a decoded one
+func equalJson(a interface{}, b interface{}) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
+
+func sameElements(a []string, b []string) bool {
+	a, b = slices.Clone(a), slices.Clone(b)
+	slices.Sort(a)
+	slices.Sort(b)
+	return slices.Equal(a, b)
+}
@@ -0,0 +1,158 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"k8s-provisioner/internal/api/v1alpha1"
+	"k8s-provisioner/internal/kube"
+	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/provisioner"
+	"k8s-provisioner/internal/readiness"
+	"log"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// todo: make configurable
+const (
+	phasePollInterval = 2 * time.Second
+	// seedingTimeout is how long seeding may take once the participant is ready
+	seedingTimeout = 5 * time.Minute
+)
+
+// ParticipantAgent provisions participants by managing their Participant objects, the ParticipantReconciler does the
+// actual work. Plans are computed by the agent that the reconciler uses.
+type ParticipantAgent struct {
+	ctx        context.Context
+	kubeClient client.Client
+	delegate   provisioner.ProvisioningAgent
+	// readinessTimeout applies to participants whose profile does not specify one
+	readinessTimeout time.Duration
+}
+
+func NewParticipantAgent(ctx context.Context, kubeClient client.Client, delegate provisioner.ProvisioningAgent, readinessTimeout time.Duration) provisioner.ProvisioningAgent {
+	return &ParticipantAgent{
+		ctx:              ctx,
+		kubeClient:       kubeClient,
+		delegate:         delegate,
+		readinessTimeout: readinessTimeout,
+	}
+}
+
+// CreateResources creates or updates the Participant object and invokes the callback once the reconciler has seeded
+// the participant, or once it failed or did not get seeded within the readiness timeout of its profile
+func (a *ParticipantAgent) CreateResources(definition model.ParticipantDefinition, readyCallback provisioner.ReadinessCallback) ([]model.AppliedObject, error) {
+	profile, err := provisioner.LookupProfile(definition.Profile)
+	if err != nil {
+		return nil, err
+	}
+	participant, err := a.apply(definition)
+	if err != nil {
+		return nil, err
+	}
+	timeout := profile.ReadinessTimeout
+	if timeout <= 0 {
+		timeout = a.readinessTimeout
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(a.ctx, timeout+seedingTimeout)
+		defer cancel()
+		err := a.waitForSeeded(ctx, participant.Name, participant.Generation)
+		if err != nil {
+			log.Printf("Error waiting for participant %s: %v\n", participant.Name, err)
+		}
+		readyCallback(definition, err)
+	}()
+	return participantResources(participant), nil
+}
+
+func (a *ParticipantAgent) ApplyResources(definition model.ParticipantDefinition) ([]model.AppliedObject, error) {
+	participant, err := a.apply(definition)
+	if err != nil {
+		return nil, err
+	}
+	return participantResources(participant), nil
+}
+
+func (a *ParticipantAgent) DeleteResources(definition model.ParticipantDefinition) ([]model.AppliedObject, error) {
+	participant := &v1alpha1.Participant{ObjectMeta: metav1.ObjectMeta{Name: definition.ParticipantName}}
+	if err := a.kubeClient.Delete(a.ctx, participant); client.IgnoreNotFound(err) != nil {
+		return nil, err
+	}
+	return participantResources(participant), nil
+}
+
+func (a *ParticipantAgent) PlanCreateResources(definition model.ParticipantDefinition) ([]model.ObjectChange, error) {
+	return a.delegate.PlanCreateResources(definition)
+}
+
+func (a *ParticipantAgent) PlanDeleteResources(definition model.ParticipantDefinition) ([]model.ObjectChange, error) {
+	return a.delegate.PlanDeleteResources(definition)
+}
+
+func (a *ParticipantAgent) History(participantName string) ([]model.ManifestRevision, error) {
+	return a.delegate.History(participantName)
+}
+
+// RollbackResources is not supported, the reconciler would immediately converge the participant to the current
+// templates again
+func (a *ParticipantAgent) RollbackResources(participantName string, version int) ([]model.AppliedObject, error) {
+	return nil, errors.New("rollback is not supported in controller mode, the Participant is reconciled with the current templates")
+}
+
+func (a *ParticipantAgent) ReadinessGates(definition model.ParticipantDefinition) ([]readiness.Gate, error) {
+	return a.delegate.ReadinessGates(definition)
+}
+
+func (a *ParticipantAgent) Describe(definition model.ParticipantDefinition) (model.ProvisionedResources, error) {
+	return a.delegate.Describe(definition)
+}
+
+func (a *ParticipantAgent) apply(definition model.ParticipantDefinition) (*v1alpha1.Participant, error) {
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	participant := &v1alpha1.Participant{ObjectMeta: metav1.ObjectMeta{Name: definition.ParticipantName}}
+	_, err := controllerutil.CreateOrUpdate(a.ctx, a.kubeClient, participant, func() error {
+		participant.Spec = v1alpha1.SpecFromDefinition(definition)
+		return nil
+	})
+	return participant, err
+}
+
+// waitForSeeded polls the Participant until data was seeded for the given generation of its spec, until reconciling
+// that generation failed, or until the context is done
+func (a *ParticipantAgent) waitForSeeded(ctx context.Context, name string, generation int64) error {
+	participant := &v1alpha1.Participant{}
+	for {
+		if err := a.kubeClient.Get(ctx, client.ObjectKey{Name: name}, participant); err != nil {
+			return err
+		}
+		status := participant.Status
+		if status.Phase == v1alpha1.PhaseSeeded && status.SeededGeneration >= generation {
+			return nil
+		}
+		if status.Phase == v1alpha1.PhaseFailed && status.ObservedGeneration >= generation {
+			if status.Reason == "" {
+				// not a readiness failure, e.g. the resources could not be applied
+				return fmt.Errorf("participant %s failed: %s", name, status.Message)
+			}
+			return &kube.ReadinessError{Namespace: name, Reason: status.Reason, Message: status.Message}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("participant %s was not seeded in time: %w", name, ctx.Err())
+		case <-time.After(phasePollInterval):
+			continue
+		}
+	}
+}
+
+func participantResources(participant *v1alpha1.Participant) []model.AppliedObject {
+	return []model.AppliedObject{{Kind: "Participant", Name: participant.Name}}
+}
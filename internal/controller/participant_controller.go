@@ -0,0 +1,212 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"k8s-provisioner/internal/api/v1alpha1"
+	"k8s-provisioner/internal/kube"
+	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/provisioner"
+	"k8s-provisioner/internal/readiness"
+	"log"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// finalizer makes sure the resources of a participant are removed before its Participant object is deleted
+const finalizer = "provisioner.fulcrum.io/cleanup"
+
+// todo: make configurable
+const (
+	readinessRequeueInterval = 5 * time.Second
+	resyncInterval           = 5 * time.Minute
+)
+
+// ParticipantReconciler continuously converges the namespace of every Participant towards the resources of its
+// profile, waits for them to become ready and seeds the participant data once per spec generation
+type ParticipantReconciler struct {
+	client.Client
+	Agent  provisioner.ProvisioningAgent
+	Seeder func(model.ParticipantDefinition) error
+}
+
+// ReasonSeedingFailed is the status reason of a participant whose data could not be seeded
+const ReasonSeedingFailed = "SeedingFailed"
+
+func (r *ParticipantReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&v1alpha1.Participant{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// the namespace of a participant has the participant's name, so drift of any deployment in it is repaired. Status
+		// updates are ignored, readiness is polled while the participant is not ready.
+		Watches(&appsv1.Deployment{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, object client.Object) []reconcile.Request {
+			return []reconcile.Request{{NamespacedName: client.ObjectKey{Name: object.GetNamespace()}}}
+		}), builder.WithPredicates(predicate.GenerationChangedPredicate{}, managedPredicate)).
+		Complete(r)
+}
+
+func (r *ParticipantReconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	participant := &v1alpha1.Participant{}
+	if err := r.Get(ctx, request.NamespacedName, participant); err != nil {
+		return reconcile.Result{}, client.IgnoreNotFound(err)
+	}
+	definition := participant.Definition()
+
+	if !participant.DeletionTimestamp.IsZero() {
+		return reconcile.Result{}, r.delete(ctx, participant)
+	}
+	if controllerutil.AddFinalizer(participant, finalizer) {
+		if err := r.Update(ctx, participant); err != nil {
+			return reconcile.Result{}, err
+		}
+	}
+
+	// also set for failures before anything was applied, so that they are attributed to the current spec
+	participant.Status.ObservedGeneration = participant.Generation
+	profile, err := provisioner.LookupProfile(definition.Profile)
+	if err != nil {
+		// retrying does not help until the spec changes
+		return reconcile.Result{}, r.setPhase(ctx, participant, v1alpha1.PhaseFailed, err.Error())
+	}
+	// applying prunes and records the history, so it is skipped unless the spec changed or a deployment drifted
+	drifted, err := r.drifted(ctx, participant)
+	if err != nil {
+		return reconcile.Result{}, r.failed(ctx, participant, "", err)
+	}
+	if participant.Status.AppliedGeneration != participant.Generation || drifted {
+		resources, err := r.Agent.ApplyResources(definition)
+		if err != nil {
+			return reconcile.Result{}, r.failed(ctx, participant, "", err)
+		}
+		participant.Status.AppliedObjects = appliedObjects(resources)
+		participant.Status.AppliedGeneration = participant.Generation
+	}
+	if definition.Stopped {
+		// nothing to wait for or seed, starting the participant changes the spec and seeds the data again
+		participant.Status.ReadyDeployments = nil
+		return reconcile.Result{RequeueAfter: resyncInterval}, r.setPhase(ctx, participant, v1alpha1.PhaseStopped, "")
+	}
+
+	ready, err := kube.ReadyDeployments(r.Client, ctx, participant.Name, profile.Deployments)
+	if err != nil {
+		return reconcile.Result{}, r.failed(ctx, participant, "", err)
+	}
+	participant.Status.ReadyDeployments = ready
+
+	// data is only seeded once all gates passed, which includes the deployments
+	gates, err := r.Agent.ReadinessGates(definition)
+	if err != nil {
+		return reconcile.Result{}, r.failed(ctx, participant, "", err)
+	}
+	passed, failure := readiness.Passed(ctx, gates)
+	if failure != nil {
+		// the participant may still recover, e.g. once a missing image was pushed
+		participant.Status.Reason = failure.Reason
+		message := failure.Message
+		if failure.Deployment != "" {
+			message = "deployment " + failure.Deployment + ": " + message
+		}
+		return reconcile.Result{RequeueAfter: readinessRequeueInterval}, r.setPhase(ctx, participant, v1alpha1.PhaseFailed, message)
+	}
+	if len(passed) < len(gates) {
+		message := fmt.Sprintf("%d/%d readiness gates passed", len(passed), len(gates))
+		return reconcile.Result{RequeueAfter: readinessRequeueInterval}, r.setPhase(ctx, participant, v1alpha1.PhaseApplied, message)
+	}
+
+	if participant.Status.SeededGeneration != participant.Generation {
+		if err := r.setPhase(ctx, participant, v1alpha1.PhaseReady, "seeding data"); err != nil {
+			return reconcile.Result{}, err
+		}
+		if err := r.Seeder(definition); err != nil {
+			return reconcile.Result{}, r.failed(ctx, participant, ReasonSeedingFailed, err)
+		}
+		participant.Status.SeededGeneration = participant.Generation
+	}
+	return reconcile.Result{RequeueAfter: resyncInterval}, r.setPhase(ctx, participant, v1alpha1.PhaseSeeded, "")
+}
+
+// managedPredicate selects the objects the provisioner applied
+var managedPredicate = predicate.NewPredicateFuncs(func(object client.Object) bool {
+	return object.GetLabels()[provisioner.LabelManagedBy] == provisioner.ManagedBy
+})
+
+// drifted is true if a deployment applied for the participant was removed, or its spec was changed by someone else
+func (r *ParticipantReconciler) drifted(ctx context.Context, participant *v1alpha1.Participant) (bool, error) {
+	for _, object := range participant.Status.AppliedObjects {
+		if object.Kind != "Deployment" {
+			continue
+		}
+		deployment := &appsv1.Deployment{}
+		err := r.Get(ctx, client.ObjectKey{Namespace: participant.Name, Name: object.Name}, deployment)
+		if apierrors.IsNotFound(err) {
+			log.Printf("Deployment %s of participant %s was removed\n", object.Name, participant.Name)
+			return true, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if deployment.Generation != object.Generation {
+			log.Printf("Deployment %s of participant %s was changed\n", object.Name, participant.Name)
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *ParticipantReconciler) delete(ctx context.Context, participant *v1alpha1.Participant) error {
+	if !controllerutil.ContainsFinalizer(participant, finalizer) {
+		return nil
+	}
+	if err := r.setPhase(ctx, participant, v1alpha1.PhaseDeleting, ""); err != nil {
+		return err
+	}
+	if _, err := r.Agent.DeleteResources(participant.Definition()); err != nil {
+		return r.failed(ctx, participant, "", err)
+	}
+	log.Println("Deleted resources of participant", participant.Name)
+	controllerutil.RemoveFinalizer(participant, finalizer)
+	return r.Update(ctx, participant)
+}
+
+// failed records the error and the optional reason in the status and returns the error, so that the reconciliation is
+// retried with back-off
+func (r *ParticipantReconciler) failed(ctx context.Context, participant *v1alpha1.Participant, reason string, err error) error {
+	log.Printf("Error reconciling participant %s: %v\n", participant.Name, err)
+	participant.Status.Reason = reason
+	if statusErr := r.setPhase(ctx, participant, v1alpha1.PhaseFailed, err.Error()); statusErr != nil {
+		return statusErr
+	}
+	return err
+}
+
+func (r *ParticipantReconciler) setPhase(ctx context.Context, participant *v1alpha1.Participant, phase string, message string) error {
+	if phase != v1alpha1.PhaseFailed {
+		participant.Status.Reason = ""
+	}
+	participant.Status.Phase = phase
+	participant.Status.Message = message
+	return r.Status().Update(ctx, participant)
+}
+
+func appliedObjects(resources []model.AppliedObject) []v1alpha1.AppliedObject {
+	objects := make([]v1alpha1.AppliedObject, 0, len(resources))
+	for _, resource := range resources {
+		objects = append(objects, v1alpha1.AppliedObject{Kind: resource.Kind, Name: resource.Name, Generation: resource.Generation})
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		if objects[i].Kind != objects[j].Kind {
+			return objects[i].Kind < objects[j].Kind
+		}
+		return objects[i].Name < objects[j].Name
+	})
+	return objects
+}
@@ -0,0 +1,289 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"k8s-provisioner/clients/fulcrum"
+	"k8s-provisioner/internal/kube"
+	"k8s-provisioner/internal/model"
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// statusPending is the status of a Fulcrum job that no agent has claimed yet
+const statusPending = "Pending"
+
+// todo: make configurable
+const (
+	reportRetryInterval = 5 * time.Second
+	reportMaxBackoff    = 5 * time.Minute
+)
+
+// Handler processes a claimed job until it is complete, continuing after the phase the job reached before. It returns
+// the result the job is finalized with, or a StageError or any other error if it failed. The context expires when the
+// job runs out of time.
+type Handler func(ctx context.Context, job *Job) (model.JobResult, error)
+
+// Job is a claimed job and its progress
+type Job struct {
+	model.PendingJob
+	// Phase is the last phase the job reached
+	Phase string
+	// Failure is set once the job failed, it is reported to Fulcrum Core instead of processing the job again
+	Failure string
+	// Objects are the objects applied for the job, recorded along with PhaseApplied
+	Objects []model.AppliedObject
+	store   Store
+}
+
+// Advance records that the job reached the phase. Handlers must call it from the goroutine they were invoked on, so
+// that no progress is recorded once the job was failed or finalized.
+func (j *Job) Advance(phase string) {
+	j.Phase = phase
+	if err := j.store.Save(Record{Job: j.PendingJob, Phase: phase, Objects: j.Objects}); err != nil {
+		// the phase is repeated if the provisioner restarts before the next one is recorded
+		log.Printf("Error recording phase %s of job %s: %s\n", phase, j.Id, err)
+	}
+}
+
+// Applied records the objects applied for the job and advances it to PhaseApplied, so that a resumed job reports them
+func (j *Job) Applied(objects []model.AppliedObject) {
+	j.Objects = objects
+	j.Advance(PhaseApplied)
+}
+
+// fail records the failure of the job, so that it is reported after a restart if reporting it fails until then
+func (j *Job) fail(message string) {
+	j.Failure = message
+	if err := j.store.Save(Record{Job: j.PendingJob, Phase: j.Phase, Failure: message, Objects: j.Objects}); err != nil {
+		log.Printf("Error recording failure of job %s: %s\n", j.Id, err)
+	}
+}
+
+// Reached is true if the job has completed the phase before
+func (j *Job) Reached(phase string) bool {
+	return slices.Index(phases, j.Phase) >= slices.Index(phases, phase)
+}
+
+// Options configure the capacity of a Dispatcher
+type Options struct {
+	// Workers is the number of jobs processed concurrently
+	Workers int
+	// QueueSize is the number of claimed jobs that may wait for a worker
+	QueueSize int
+	// JobTimeout limits how long a single job may take, including the readiness of its deployments
+	JobTimeout time.Duration
+}
+
+// Dispatcher claims pending Fulcrum jobs and processes them on a bounded pool of workers. A job is only claimed if a
+// worker or a queue slot is free for it, the remaining jobs stay pending in Fulcrum Core until the next poll.
+type Dispatcher struct {
+	ctx        context.Context
+	apiClient  clients.FulcrumApi
+	agentToken func() string
+	store      Store
+	handler    Handler
+	options    Options
+
+	queue chan *Job
+	// slots holds a value for every claimed job that is queued or being processed
+	slots     chan struct{}
+	pollMutex sync.Mutex
+}
+
+func NewDispatcher(ctx context.Context, apiClient clients.FulcrumApi, agentToken func() string, store Store, handler Handler, options Options) *Dispatcher {
+	options.Workers = max(options.Workers, 1)
+	options.QueueSize = max(options.QueueSize, 0)
+	return &Dispatcher{
+		ctx:        ctx,
+		apiClient:  apiClient,
+		agentToken: agentToken,
+		store:      store,
+		handler:    handler,
+		options:    options,
+		queue:      make(chan *Job, options.QueueSize),
+		slots:      make(chan struct{}, options.Workers+options.QueueSize),
+	}
+}
+
+// Start runs the workers and polls whenever one of the sources asks to, until the context of the dispatcher is done
+func (d *Dispatcher) Start(sources ...Source) {
+	for i := 0; i < d.options.Workers; i++ {
+		go d.work()
+	}
+	for _, source := range sources {
+		go source.Run(d.ctx, d.Poll)
+	}
+	log.Printf("Started %d job workers\n", d.options.Workers)
+}
+
+// Resume queues the jobs that were claimed before the provisioner restarted, they continue after the phase they
+// reached. Jobs beyond the capacity of the dispatcher wait in the background for a free slot.
+func (d *Dispatcher) Resume() error {
+	records, err := d.store.List()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		job := &Job{PendingJob: record.Job, Phase: record.Phase, Failure: record.Failure, Objects: record.Objects, store: d.store}
+		if job.Failure != "" {
+			log.Printf("Resuming report of failed job %s (\"%s\")\n", job.Id, job.Service.Name)
+		} else {
+			log.Printf("Resuming job %s (\"%s\") after phase %s\n", job.Id, job.Service.Name, job.Phase)
+		}
+		go func() {
+			select {
+			case <-d.ctx.Done():
+			case d.slots <- struct{}{}:
+				d.queue <- job
+			}
+		}()
+	}
+	return nil
+}
+
+// Poll fetches the pending jobs and claims as many of them as there is capacity for. Polls of several sources do not
+// overlap, so that no job is claimed twice.
+func (d *Dispatcher) Poll() error {
+	d.pollMutex.Lock()
+	defer d.pollMutex.Unlock()
+
+	jobs, err := d.apiClient.GetPendingJobs(d.agentToken())
+	if err != nil {
+		return fmt.Errorf("get pending jobs: %w", err)
+	}
+	if len(jobs) > 0 {
+		log.Printf("Got %d pending jobs\n", len(jobs))
+	}
+
+	for i, job := range jobs {
+		if job.Status != statusPending {
+			log.Printf("Pending Job in status %s", job.Status)
+			continue
+		}
+		select {
+		case d.slots <- struct{}{}:
+		default:
+			log.Printf("All job workers are busy, leaving %d jobs for the next poll\n", len(jobs)-i)
+			return nil
+		}
+		claimed := &Job{PendingJob: job, Phase: PhaseClaiming, store: d.store}
+		if err := d.store.Save(Record{Job: job, Phase: PhaseClaiming}); err != nil {
+			log.Printf("Error recording job %s, leaving it for the next poll: %s\n", job.Id, err)
+			<-d.slots
+			continue
+		}
+		if err := d.apiClient.ClaimJob(d.agentToken(), job.Id); err != nil {
+			// most likely another agent claimed it first
+			log.Printf("Error claiming job %s: %s\n", job.Id, err)
+			d.forget(job.Id)
+			<-d.slots
+			continue
+		}
+		log.Printf("Claimed job %s (\"%s\"), Action = %s\n", job.Id, job.Service.Name, job.Action)
+		claimed.Advance(PhaseClaimed)
+		// never blocks, the slots bound the number of queued jobs
+		d.queue <- claimed
+	}
+	return nil
+}
+
+func (d *Dispatcher) work() {
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case job := <-d.queue:
+			d.process(job)
+			<-d.slots
+		}
+	}
+}
+
+// process handles the job and reports its outcome to Fulcrum Core. The record of the job is only removed once the
+// outcome was reported, a job whose outcome could not be reported before the provisioner stops is resumed: a failure
+// is reported again, a successful job continues after its last phase and is finalized.
+func (d *Dispatcher) process(job *Job) {
+	if job.Phase == PhaseClaiming {
+		// the provisioner stopped before it recorded whether the claim succeeded, pending jobs are only offered to this
+		// agent, so a claim that fails now was most likely made before
+		if err := d.apiClient.ClaimJob(d.agentToken(), job.Id); err != nil {
+			log.Printf("Error claiming job %s again, continuing with the earlier claim: %s\n", job.Id, err)
+		}
+		job.Advance(PhaseClaimed)
+	}
+	if job.Failure == "" {
+		ctx, cancel := context.WithTimeout(d.ctx, d.options.JobTimeout)
+		result, err := d.handler(ctx, job)
+		cancel()
+		if err == nil {
+			if d.report(job.Id, "finalizing", func() error {
+				return d.apiClient.FinalizeJob(d.agentToken(), job.Id, result)
+			}) {
+				log.Printf("Finalized job: %s\n", job.Id)
+				d.forget(job.Id)
+			}
+			return
+		}
+		if d.ctx.Err() != nil {
+			// the provisioner is shutting down, the job is resumed after the restart
+			return
+		}
+		log.Printf("Job %s failed: %s\n", job.Id, err)
+		job.fail(failureMessage(err))
+	}
+	if d.report(job.Id, "failing", func() error {
+		return d.apiClient.FailJob(d.agentToken(), job.Id, job.Failure)
+	}) {
+		log.Printf("Failed job %s: %s\n", job.Id, job.Failure)
+		d.forget(job.Id)
+	}
+}
+
+// report invokes the API call that reports the outcome of a job until it succeeds, backing off exponentially after
+// errors. It returns false if the dispatcher is stopped before.
+func (d *Dispatcher) report(jobId string, operation string, call func() error) bool {
+	wait := reportRetryInterval
+	for {
+		err := call()
+		if err == nil {
+			return true
+		}
+		log.Printf("Error %s job %s, retrying in %s: %s\n", operation, jobId, wait, err)
+		select {
+		case <-d.ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+		wait = min(2*wait, reportMaxBackoff)
+	}
+}
+
+// forget removes the record of a job that Fulcrum Core was told the outcome of
+func (d *Dispatcher) forget(jobId string) {
+	if err := d.store.Delete(jobId); err != nil {
+		log.Printf("Error removing record of job %s: %s\n", jobId, err)
+	}
+}
+
+// failureMessage describes the failure of a job for Fulcrum Core, with the stage and, for readiness failures, the
+// reason
+func failureMessage(err error) string {
+	stage := StageProcessing
+	var stageError *StageError
+	if errors.As(err, &stageError) {
+		stage = stageError.Stage
+		err = stageError.Err
+	}
+	reason := "Error"
+	var readinessError *kube.ReadinessError
+	if errors.As(err, &readinessError) {
+		reason = readinessError.Reason
+	} else if errors.Is(err, context.DeadlineExceeded) {
+		reason = kube.ReasonTimeout
+	}
+	return fmt.Sprintf("%s failed (%s): %s", stage, reason, err)
+}
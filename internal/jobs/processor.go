@@ -0,0 +1,250 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/provisioner"
+	"k8s-provisioner/internal/readiness"
+	"log"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// stages of a job in which it can fail, reported to Fulcrum Core
+const (
+	StageValidation   = "validation"
+	StageProvisioning = "provisioning"
+	StageReadiness    = "readiness"
+	StageSeeding      = "seeding"
+	// StageProcessing is reported for errors that are not attributed to a specific stage
+	StageProcessing = "processing"
+)
+
+// StageError is the failure of a job in a specific stage
+type StageError struct {
+	Stage string
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return e.Stage + ": " + e.Err.Error()
+}
+
+func (e *StageError) Unwrap() error {
+	return e.Err
+}
+
+func stageError(stage string, err error) error {
+	return &StageError{Stage: stage, Err: err}
+}
+
+// Processor provisions the participants of Fulcrum jobs through the provisioning agent
+type Processor struct {
+	Agent provisioner.ProvisioningAgent
+	// Seeder creates the participant data once the deployments are ready. It is invoked again for a job that is resumed
+	// after the provisioner restarted while seeding, so it must tolerate data that already exists.
+	Seeder func(model.ParticipantDefinition) error
+	// KubeClient reads the current state of participants
+	KubeClient client.Client
+	// ServiceTypeProfiles maps the ids of the service types registered in Fulcrum Core to the profile they provision
+	ServiceTypeProfiles map[string]string
+}
+
+// actions of Fulcrum jobs. Hot updates change a running service, cold updates a stopped one.
+const (
+	ActionCreate     = "Create"
+	ActionUpdate     = "Update"
+	ActionHotUpdate  = "HotUpdate"
+	ActionColdUpdate = "ColdUpdate"
+	ActionStart      = "Start"
+	ActionStop       = "Stop"
+	ActionDelete     = "Delete"
+)
+
+// Handle is the Handler of a Dispatcher
+func (p *Processor) Handle(ctx context.Context, job *Job) (model.JobResult, error) {
+	def, err := definition(job.PendingJob, p.ServiceTypeProfiles)
+	if err != nil {
+		return model.JobResult{}, stageError(StageValidation, err)
+	}
+	result := model.JobResult{ExternalId: externalId(def)}
+	switch job.Action {
+	case ActionUpdate, ActionHotUpdate:
+		// updates keep a stopped participant stopped, only Start scales it up again
+		def.Stopped, err = p.stopped(ctx, def.ParticipantName)
+		if err != nil {
+			return result, stageError(StageProvisioning, err)
+		}
+		if def.Stopped {
+			result.Resources, err = p.stop(ctx, job, def)
+		} else {
+			result.Resources, err = p.create(ctx, job, def)
+		}
+	case ActionCreate, ActionStart:
+		// re-applying the templates with the current properties creates the participant or scales it up again
+		result.Resources, err = p.create(ctx, job, def)
+	case ActionStop, ActionColdUpdate:
+		def.Stopped = true
+		result.Resources, err = p.stop(ctx, job, def)
+	case ActionDelete:
+		// deleting is idempotent, so a resumed deletion simply starts over
+		if _, err := p.Agent.DeleteResources(def); err != nil {
+			return result, stageError(StageProvisioning, err)
+		}
+		log.Println("Resource deletion complete.")
+	default:
+		err = stageError(StageValidation, fmt.Errorf("unsupported action %q", job.Action))
+	}
+	return result, err
+}
+
+// create provisions the participant and blocks until its data is seeded, or the job runs out of time
+func (p *Processor) create(ctx context.Context, job *Job, def model.ParticipantDefinition) (model.ProvisionedResources, error) {
+	if !job.Reached(PhaseApplied) {
+		// buffered, so that the callback does not block if the job timed out before
+		ready := make(chan error, 1)
+		created, err := p.Agent.CreateResources(def, func(_ model.ParticipantDefinition, err error) {
+			ready <- err
+		})
+		if err != nil {
+			return model.ProvisionedResources{}, stageError(StageProvisioning, err)
+		}
+		job.Applied(created)
+		select {
+		case err := <-ready:
+			if err != nil {
+				return model.ProvisionedResources{}, stageError(StageReadiness, err)
+			}
+		case <-ctx.Done():
+			return model.ProvisionedResources{}, stageError(StageReadiness, ctx.Err())
+		}
+		job.Advance(PhaseReady)
+	} else if !job.Reached(PhaseReady) {
+		if err := p.waitForReadiness(ctx, def); err != nil {
+			return model.ProvisionedResources{}, err
+		}
+		job.Advance(PhaseReady)
+	}
+
+	if !job.Reached(PhaseSeeded) {
+		if err := p.Seeder(def); err != nil {
+			return model.ProvisionedResources{}, stageError(StageSeeding, err)
+		}
+		job.Advance(PhaseSeeded)
+	}
+	return p.resources(def, job.Objects)
+}
+
+// stopped is true if the participant was last applied stopped
+func (p *Processor) stopped(ctx context.Context, name string) (bool, error) {
+	participant, found, err := provisioner.LookupParticipant(p.KubeClient, ctx, name)
+	if err != nil {
+		return false, fmt.Errorf("read participant %s: %w", name, err)
+	}
+	return found && participant.Definition.Stopped, nil
+}
+
+// stop scales the workloads of the participant to zero and waits until they are scaled down
+func (p *Processor) stop(ctx context.Context, job *Job, def model.ParticipantDefinition) (model.ProvisionedResources, error) {
+	if !job.Reached(PhaseApplied) {
+		applied, err := p.Agent.ApplyResources(def)
+		if err != nil {
+			return model.ProvisionedResources{}, stageError(StageProvisioning, err)
+		}
+		job.Applied(applied)
+	}
+	if !job.Reached(PhaseReady) {
+		if err := p.waitForReadiness(ctx, def); err != nil {
+			return model.ProvisionedResources{}, err
+		}
+		job.Advance(PhaseReady)
+	}
+	log.Println("Stopped participant", def.ParticipantName)
+	return p.resources(def, job.Objects)
+}
+
+// resources describes the provisioned participant with the objects that were applied for the job
+func (p *Processor) resources(def model.ParticipantDefinition, objects []model.AppliedObject) (model.ProvisionedResources, error) {
+	resources, err := p.Agent.Describe(def)
+	if err != nil {
+		return resources, stageError(StageProcessing, err)
+	}
+	resources.Objects = objects
+	return resources, nil
+}
+
+// externalId identifies the participant of a job in Fulcrum Core, so that all jobs of a service report the same id
+func externalId(def model.ParticipantDefinition) string {
+	return "go-provisioner-" + def.ParticipantName
+}
+
+// waitForReadiness waits for the readiness gates of resources that were applied before. The gates read the workloads
+// from the API server and only pass once their current generation is rolled out, so a resumed update or stop does not
+// report the replicas of the previous generation as ready.
+func (p *Processor) waitForReadiness(ctx context.Context, def model.ParticipantDefinition) error {
+	gates, err := p.Agent.ReadinessGates(def)
+	if err != nil {
+		return stageError(StageReadiness, err)
+	}
+	if err := readiness.Wait(ctx, def.ParticipantName, gates); err != nil {
+		return stageError(StageReadiness, err)
+	}
+	return nil
+}
+
+// definition builds the participant definition from the properties of the job's service, and rejects properties that
+// are missing or malformed as well as services of unknown types
+func definition(job model.PendingJob, serviceTypeProfiles map[string]string) (model.ParticipantDefinition, error) {
+	properties, err := serviceProperties(job.Service.Properties)
+	if err != nil {
+		return model.ParticipantDefinition{}, err
+	}
+	if err := model.Validate(properties); err != nil {
+		return model.ParticipantDefinition{}, fmt.Errorf("service properties: %w", err)
+	}
+	profile, err := serviceProfile(job.Service.ServiceTypeId, properties, serviceTypeProfiles)
+	if err != nil {
+		return model.ParticipantDefinition{}, err
+	}
+	return model.ParticipantDefinition{
+		ParticipantName:       properties.ParticipantName,
+		Did:                   properties.ParticipantDid,
+		KubernetesIngressHost: properties.KubeHost,
+		Components:            properties.Components,
+		Profile:               profile,
+	}, nil
+}
+
+// serviceProperties converts the untyped properties of a Fulcrum service, properties the provisioner does not know
+// are ignored
+func serviceProperties(raw map[string]interface{}) (model.ServiceProperties, error) {
+	var properties model.ServiceProperties
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return properties, err
+	}
+	if err := json.Unmarshal(data, &properties); err != nil {
+		var typeError *json.UnmarshalTypeError
+		if errors.As(err, &typeError) {
+			return properties, fmt.Errorf("service property %s: must be of type %s, got %s", typeError.Field, typeError.Type, typeError.Value)
+		}
+		return properties, fmt.Errorf("service properties: %w", err)
+	}
+	return properties, nil
+}
+
+// serviceProfile selects the profile of a job from the "profile" service property, or from the profile of its service
+// type. Services of a type the provisioner did not register are rejected.
+func serviceProfile(serviceTypeId string, properties model.ServiceProperties, serviceTypeProfiles map[string]string) (string, error) {
+	profile, found := serviceTypeProfiles[serviceTypeId]
+	if !found {
+		return "", fmt.Errorf("unknown service type %q", serviceTypeId)
+	}
+	if properties.Profile != "" {
+		return properties.Profile, nil
+	}
+	return profile, nil
+}
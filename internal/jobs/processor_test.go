@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"k8s-provisioner/internal/model"
+	"testing"
+)
+
+func TestServiceProfile(t *testing.T) {
+	serviceTypeProfiles := map[string]string{
+		"0b6c5c8e-connector": "connector-only",
+		"7f2d1a44-aio":       "edc-aio",
+	}
+	tests := []struct {
+		name          string
+		serviceTypeId string
+		profile       string
+		want          string
+		wantErr       bool
+	}{
+		{name: "profile of the service type", serviceTypeId: "0b6c5c8e-connector", want: "connector-only"},
+		{name: "profile property overrides the service type", serviceTypeId: "7f2d1a44-aio", profile: "identityhub-only", want: "identityhub-only"},
+		{name: "unknown service type", serviceTypeId: "unknown", wantErr: true},
+		{name: "unknown service type with a profile property", serviceTypeId: "unknown", profile: "edc-aio", wantErr: true},
+		{name: "service type named after a profile is not enough", serviceTypeId: "edc-aio", wantErr: true},
+		{name: "missing service type", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := serviceProfile(test.serviceTypeId, model.ServiceProperties{Profile: test.profile}, serviceTypeProfiles)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("serviceProfile() error = %v, want error: %t", err, test.wantErr)
+			}
+			if got != test.want {
+				t.Errorf("serviceProfile() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Source tells the dispatcher when to look for pending jobs
+type Source interface {
+	// Run invokes poll whenever there may be pending jobs, until the context is done. poll returns an error if the
+	// pending jobs could not be fetched.
+	Run(ctx context.Context, poll func() error)
+}
+
+// PollingSource polls in a fixed interval with a random jitter, so that replicas and restarts do not poll in lockstep.
+// After failed polls it backs off exponentially, up to MaxBackoff.
+type PollingSource struct {
+	Interval time.Duration
+	// Jitter is the maximum random deviation from the interval, in either direction
+	Jitter     time.Duration
+	MaxBackoff time.Duration
+}
+
+func (s PollingSource) Run(ctx context.Context, poll func() error) {
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.delay(failures)):
+		}
+		if err := poll(); err != nil {
+			failures++
+			log.Printf("Polling Fulcrum Core failed %d times in a row, next poll in %s: %v\n", failures, s.delay(failures), err)
+		} else {
+			failures = 0
+		}
+	}
+}
+
+// delay returns the time until the next poll, without jitter while backing off
+func (s PollingSource) delay(failures int) time.Duration {
+	if failures > 0 {
+		backoff := s.Interval
+		for i := 0; i < failures && backoff < s.MaxBackoff; i++ {
+			backoff *= 2
+		}
+		return min(backoff, max(s.MaxBackoff, s.Interval))
+	}
+	if s.Jitter <= 0 {
+		return s.Interval
+	}
+	return max(s.Interval+time.Duration(rand.Int64N(int64(2*s.Jitter)))-s.Jitter, 0)
+}
+
+// SignatureHeader is the header that carries the signature of a notification
+const SignatureHeader = "X-Signature-256"
+
+// signaturePrefix precedes the hex encoded HMAC-SHA256 of the body in the signature of a notification
+const signaturePrefix = "sha256="
+
+// ErrInvalidSignature is returned for notifications that are not signed with the shared secret
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// WebhookSource polls as soon as Fulcrum Core, or a relay, notifies the provisioner about new jobs. Notifications only
+// trigger a poll, the jobs themselves are always fetched from Fulcrum Core. Notifications that arrive while a poll is
+// pending are merged into it.
+type WebhookSource struct {
+	secret   []byte
+	notified chan struct{}
+}
+
+func NewWebhookSource(secret string) *WebhookSource {
+	return &WebhookSource{
+		secret:   []byte(secret),
+		notified: make(chan struct{}, 1),
+	}
+}
+
+// Notify verifies the signature of a notification, which is "sha256=" followed by the hex encoded HMAC-SHA256 of the
+// body, and triggers a poll if it is valid
+func (s *WebhookSource) Notify(body []byte, signature string) error {
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, signaturePrefix))
+	if err != nil || !strings.HasPrefix(signature, signaturePrefix) {
+		return ErrInvalidSignature
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return ErrInvalidSignature
+	}
+	select {
+	case s.notified <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (s *WebhookSource) Run(ctx context.Context, poll func() error) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.notified:
+			if err := poll(); err != nil {
+				// the polling source picks the jobs up later
+				log.Printf("Polling Fulcrum Core after a notification failed: %v\n", err)
+			}
+		}
+	}
+}
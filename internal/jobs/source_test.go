@@ -0,0 +1,106 @@
+package jobs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPollingDelay(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   PollingSource
+		failures int
+		want     time.Duration
+	}{
+		{name: "interval", source: PollingSource{Interval: 10 * time.Second, MaxBackoff: 5 * time.Minute}, want: 10 * time.Second},
+		{name: "first failure", source: PollingSource{Interval: 10 * time.Second, MaxBackoff: 5 * time.Minute}, failures: 1, want: 20 * time.Second},
+		{name: "second failure", source: PollingSource{Interval: 10 * time.Second, MaxBackoff: 5 * time.Minute}, failures: 2, want: 40 * time.Second},
+		{name: "capped", source: PollingSource{Interval: 10 * time.Second, MaxBackoff: 5 * time.Minute}, failures: 5, want: 5 * time.Minute},
+		{name: "many failures", source: PollingSource{Interval: 10 * time.Second, MaxBackoff: 5 * time.Minute}, failures: 100, want: 5 * time.Minute},
+		{name: "backoff below interval", source: PollingSource{Interval: 10 * time.Second, MaxBackoff: time.Second}, failures: 3, want: 10 * time.Second},
+		{name: "no jitter while backing off", source: PollingSource{Interval: 10 * time.Second, Jitter: 5 * time.Second, MaxBackoff: time.Minute}, failures: 1, want: 20 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.source.delay(test.failures); got != test.want {
+				t.Errorf("delay(%d) = %s, want %s", test.failures, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPollingJitter(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   PollingSource
+		min, max time.Duration
+	}{
+		{name: "around the interval", source: PollingSource{Interval: 10 * time.Second, Jitter: 2 * time.Second}, min: 8 * time.Second, max: 12 * time.Second},
+		{name: "never negative", source: PollingSource{Interval: time.Second, Jitter: 5 * time.Second}, min: 0, max: 6 * time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 1000; i++ {
+				if got := test.source.delay(0); got < test.min || got >= test.max {
+					t.Fatalf("delay(0) = %s, want it in [%s, %s)", got, test.min, test.max)
+				}
+			}
+		})
+	}
+}
+
+func sign(secret string, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookNotify(t *testing.T) {
+	const secret = "shared-secret"
+	const body = `{"jobs":1}`
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		valid     bool
+	}{
+		{name: "valid", body: body, signature: sign(secret, body), valid: true},
+		{name: "upper case hex", body: body, signature: signaturePrefix + strings.ToUpper(strings.TrimPrefix(sign(secret, body), signaturePrefix)), valid: true},
+		{name: "empty body", body: "", signature: sign(secret, ""), valid: true},
+		{name: "other secret", body: body, signature: sign("other", body)},
+		{name: "tampered body", body: `{"jobs":2}`, signature: sign(secret, body)},
+		{name: "missing prefix", body: body, signature: strings.TrimPrefix(sign(secret, body), signaturePrefix)},
+		{name: "other algorithm", body: body, signature: "sha1=" + strings.TrimPrefix(sign(secret, body), signaturePrefix)},
+		{name: "not hex", body: body, signature: signaturePrefix + "not-hex"},
+		{name: "truncated", body: body, signature: sign(secret, body)[:20]},
+		{name: "empty", body: body, signature: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := NewWebhookSource(secret)
+			err := source.Notify([]byte(test.body), test.signature)
+			if test.valid {
+				if err != nil {
+					t.Fatalf("Notify() = %v, want no error", err)
+				}
+				select {
+				case <-source.notified:
+				default:
+					t.Error("Notify() did not trigger a poll")
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidSignature) {
+				t.Fatalf("Notify() = %v, want ErrInvalidSignature", err)
+			}
+			if len(source.notified) > 0 {
+				t.Error("Notify() triggered a poll for an invalid signature")
+			}
+		})
+	}
+}
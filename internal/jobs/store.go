@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s-provisioner/internal/model"
+	"sort"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// phases of a claimed job, in this order. A job is resumed after the last phase it reached. A job is recorded as
+// claiming before it is claimed, so that it is not lost if the provisioner stops before recording the claim.
+const (
+	PhaseClaiming = "claiming"
+	PhaseClaimed  = "claimed"
+	PhaseApplied  = "applied"
+	PhaseReady    = "ready"
+	PhaseSeeded   = "seeded"
+)
+
+var phases = []string{PhaseClaiming, PhaseClaimed, PhaseApplied, PhaseReady, PhaseSeeded}
+
+// LabelJob marks the ConfigMaps that record the progress of a job, its value is the job id
+const LabelJob = "provisioner.fulcrum.io/job"
+
+// keys of a job ConfigMap
+const (
+	jobKey       = "job"
+	phaseKey     = "phase"
+	failureKey   = "failure"
+	objectsKey   = "objects"
+	updatedAtKey = "updatedAt"
+)
+
+const jobConfigMapPrefix = "provisioner-job-"
+
+// Record is the durable progress of a claimed job
+type Record struct {
+	Job   model.PendingJob
+	Phase string
+	// Failure is the message of a failed job that is yet to be reported to Fulcrum Core
+	Failure string
+	// Objects are the objects applied for the job, once it reached PhaseApplied
+	Objects   []model.AppliedObject
+	UpdatedAt time.Time
+}
+
+// Store persists the progress of claimed jobs, so that they are resumed after a restart
+type Store interface {
+	Save(record Record) error
+	Delete(jobId string) error
+	// List returns all recorded jobs, the oldest first
+	List() ([]Record, error)
+}
+
+// ConfigMapStore keeps a ConfigMap per claimed job in a single namespace
+type ConfigMapStore struct {
+	ctx        context.Context
+	kubeClient client.Client
+	namespace  string
+}
+
+func NewConfigMapStore(ctx context.Context, kubeClient client.Client, namespace string) *ConfigMapStore {
+	return &ConfigMapStore{
+		ctx:        ctx,
+		kubeClient: kubeClient,
+		namespace:  namespace,
+	}
+}
+
+func (s *ConfigMapStore) Save(record Record) error {
+	job, err := json.Marshal(record.Job)
+	if err != nil {
+		return err
+	}
+	objects, err := json.Marshal(record.Objects)
+	if err != nil {
+		return err
+	}
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: jobConfigMapPrefix + record.Job.Id}}
+	_, err = controllerutil.CreateOrUpdate(s.ctx, s.kubeClient, configMap, func() error {
+		configMap.Labels = map[string]string{LabelJob: record.Job.Id}
+		configMap.Data = map[string]string{
+			jobKey:       string(job),
+			phaseKey:     record.Phase,
+			updatedAtKey: time.Now().UTC().Format(time.RFC3339),
+		}
+		if record.Failure != "" {
+			configMap.Data[failureKey] = record.Failure
+		}
+		if record.Objects != nil {
+			configMap.Data[objectsKey] = string(objects)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("save job %s: %w", record.Job.Id, err)
+	}
+	return nil
+}
+
+func (s *ConfigMapStore) Delete(jobId string) error {
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: jobConfigMapPrefix + jobId}}
+	if err := s.kubeClient.Delete(s.ctx, configMap); client.IgnoreNotFound(err) != nil {
+		return fmt.Errorf("delete job %s: %w", jobId, err)
+	}
+	return nil
+}
+
+func (s *ConfigMapStore) List() ([]Record, error) {
+	configMaps := &corev1.ConfigMapList{}
+	if err := s.kubeClient.List(s.ctx, configMaps, client.InNamespace(s.namespace), client.HasLabels{LabelJob}); err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(configMaps.Items))
+	for _, configMap := range configMaps.Items {
+		record := Record{Phase: configMap.Data[phaseKey], Failure: configMap.Data[failureKey]}
+		if err := json.Unmarshal([]byte(configMap.Data[jobKey]), &record.Job); err != nil {
+			return nil, fmt.Errorf("config map %s: %w", configMap.Name, err)
+		}
+		if objects, found := configMap.Data[objectsKey]; found {
+			if err := json.Unmarshal([]byte(objects), &record.Objects); err != nil {
+				return nil, fmt.Errorf("config map %s: %w", configMap.Name, err)
+			}
+		}
+		// a record without a valid time sorts first
+		record.UpdatedAt, _ = time.Parse(time.RFC3339, configMap.Data[updatedAtKey])
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Job.CreatedAt.Before(records[j].Job.CreatedAt)
+	})
+	return records, nil
+}
@@ -0,0 +1,186 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// reasons of a ReadinessError, besides the waiting reasons of containers such as "ImagePullBackOff"
+const (
+	ReasonTimeout                  = "Timeout"
+	ReasonProgressDeadlineExceeded = "ProgressDeadlineExceeded"
+	ReasonReplicaFailure           = "ReplicaFailure"
+	ReasonCrashLoopBackOff         = "CrashLoopBackOff"
+)
+
+// container waiting reasons that do not resolve without a change to the deployment
+var failedWaitingReasons = map[string]bool{
+	"ImagePullBackOff":           true,
+	"InvalidImageName":           true,
+	"CreateContainerConfigError": true,
+	"CreateContainerError":       true,
+}
+
+// todo: make configurable
+const (
+	// containers usually crash a few times while their dependencies start, so a crash loop only fails the readiness
+	// check after this many restarts
+	crashLoopRestartThreshold = 3
+	// how long the details of a timeout may take to collect, after the context of the wait has expired
+	diagnosisTimeout = 5 * time.Second
+)
+
+// ReadinessError explains why a deployment did not become ready
+type ReadinessError struct {
+	Namespace string `json:"namespace"`
+	// Deployment is empty if the failure is not attributed to a specific deployment of the namespace
+	Deployment string `json:"deployment,omitempty"`
+	// Reason is a short, machine-readable cause, e.g. "ImagePullBackOff" or "Timeout"
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+func (e *ReadinessError) Error() string {
+	if e.Deployment == "" {
+		return fmt.Sprintf("namespace %s is not ready: %s: %s", e.Namespace, e.Reason, e.Message)
+	}
+	return fmt.Sprintf("deployment %s/%s is not ready: %s: %s", e.Namespace, e.Deployment, e.Reason, e.Message)
+}
+
+// DeploymentFailure inspects the conditions of the deployment and the container statuses of its pods, and returns the
+// reason why the deployment will not become ready without intervention, or nil if it may still become ready
+func DeploymentFailure(c client.Reader, ctx context.Context, deployment *appsv1.Deployment) (*ReadinessError, error) {
+	if failure := conditionFailure(deployment); failure != nil {
+		return failure, nil
+	}
+
+	pods, err := deploymentPods(c, ctx, deployment)
+	if err != nil {
+		return nil, err
+	}
+	for _, pod := range pods {
+		statuses := append(append([]corev1.ContainerStatus(nil), pod.Status.InitContainerStatuses...), pod.Status.ContainerStatuses...)
+		for _, status := range statuses {
+			if failure := containerFailure(deployment, pod, status); failure != nil {
+				return failure, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// conditionFailure returns the failure reported by the conditions of the deployment, without looking at its pods
+func conditionFailure(deployment *appsv1.Deployment) *ReadinessError {
+	for _, condition := range deployment.Status.Conditions {
+		switch {
+		case condition.Type == appsv1.DeploymentProgressing && condition.Status == corev1.ConditionFalse && condition.Reason == ReasonProgressDeadlineExceeded:
+			return readinessError(deployment, ReasonProgressDeadlineExceeded, condition.Message)
+		case condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue:
+			return readinessError(deployment, ReasonReplicaFailure, condition.Message)
+		}
+	}
+	return nil
+}
+
+// TimeoutFailure describes a deployment that did not become ready in time, with the latest warning event of its pods
+func TimeoutFailure(c client.Reader, ctx context.Context, namespace string, name string) *ReadinessError {
+	// the context of the wait has usually expired at this point
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), diagnosisTimeout)
+	defer cancel()
+
+	failure := &ReadinessError{Namespace: namespace, Deployment: name, Reason: ReasonTimeout, Message: "deployment did not become ready in time"}
+	deployment := &appsv1.Deployment{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, deployment); err != nil {
+		failure.Message += ": " + err.Error()
+		return failure
+	}
+	status := deployment.Status
+	failure.Message = fmt.Sprintf("%d of %d replicas updated, %d ready, %d available", status.UpdatedReplicas, desiredReplicas(deployment), status.ReadyReplicas, status.AvailableReplicas)
+	if status.ObservedGeneration < deployment.Generation {
+		failure.Message += fmt.Sprintf(", generation %d not observed yet", deployment.Generation)
+	}
+	if event := latestWarning(c, ctx, namespace, name); event != nil {
+		failure.Message += fmt.Sprintf(", last warning: %s: %s", event.Reason, event.Message)
+	}
+	return failure
+}
+
+func containerFailure(deployment *appsv1.Deployment, pod corev1.Pod, status corev1.ContainerStatus) *ReadinessError {
+	waiting := status.State.Waiting
+	if waiting == nil {
+		return nil
+	}
+	prefix := fmt.Sprintf("pod %s container %s: ", pod.Name, status.Name)
+	if failedWaitingReasons[waiting.Reason] {
+		return readinessError(deployment, waiting.Reason, prefix+waiting.Message)
+	}
+	if waiting.Reason == ReasonCrashLoopBackOff && status.RestartCount >= crashLoopRestartThreshold {
+		message := fmt.Sprintf("%srestarted %d times", prefix, status.RestartCount)
+		if terminated := status.LastTerminationState.Terminated; terminated != nil {
+			message += fmt.Sprintf(", last exit code %d (%s)", terminated.ExitCode, terminated.Reason)
+		}
+		return readinessError(deployment, ReasonCrashLoopBackOff, message)
+	}
+	return nil
+}
+
+func deploymentPods(c client.Reader, ctx context.Context, deployment *appsv1.Deployment) ([]corev1.Pod, error) {
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, err
+	}
+	pods := &corev1.PodList{}
+	if err := c.List(ctx, pods, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, err
+	}
+	return pods.Items, nil
+}
+
+// latestWarning returns the most recent warning event of the deployment or the replica sets and pods it owns, which
+// are named after it
+func latestWarning(c client.Reader, ctx context.Context, namespace string, deploymentName string) *corev1.Event {
+	events := &corev1.EventList{}
+	if err := c.List(ctx, events, client.InNamespace(namespace)); err != nil {
+		return nil
+	}
+	var warnings []corev1.Event
+	for _, event := range events.Items {
+		if event.Type == corev1.EventTypeWarning && strings.HasPrefix(event.InvolvedObject.Name, deploymentName) {
+			warnings = append(warnings, event)
+		}
+	}
+	if len(warnings) == 0 {
+		return nil
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		return eventTime(warnings[i]).Before(eventTime(warnings[j]))
+	})
+	return &warnings[len(warnings)-1]
+}
+
+func eventTime(event corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.CreationTimestamp.Time
+}
+
+func readinessError(deployment *appsv1.Deployment, reason string, message string) *ReadinessError {
+	return &ReadinessError{
+		Namespace:  deployment.Namespace,
+		Deployment: deployment.Name,
+		Reason:     reason,
+		Message:    message,
+	}
+}
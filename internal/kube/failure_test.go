@@ -0,0 +1,90 @@
+package kube
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConditionFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions []appsv1.DeploymentCondition
+		wantReason string
+	}{
+		{
+			name: "progressing",
+			conditions: []appsv1.DeploymentCondition{
+				{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionTrue, Reason: "ReplicaSetUpdated"},
+				{Type: appsv1.DeploymentAvailable, Status: corev1.ConditionFalse, Reason: "MinimumReplicasUnavailable"},
+			},
+		},
+		{
+			name:       "progress deadline exceeded",
+			conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Status: corev1.ConditionFalse, Reason: ReasonProgressDeadlineExceeded}},
+			wantReason: ReasonProgressDeadlineExceeded,
+		},
+		{
+			name:       "replica failure",
+			conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentReplicaFailure, Status: corev1.ConditionTrue, Reason: "FailedCreate"}},
+			wantReason: ReasonReplicaFailure,
+		},
+		{
+			name:       "resolved replica failure",
+			conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentReplicaFailure, Status: corev1.ConditionFalse}},
+		},
+		{
+			name: "no conditions",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deployment := deployment(1, nil, appsv1.DeploymentStatus{Conditions: test.conditions})
+			failure := conditionFailure(deployment)
+			switch {
+			case test.wantReason == "" && failure != nil:
+				t.Errorf("conditionFailure() = %v, want none", failure)
+			case test.wantReason != "" && (failure == nil || failure.Reason != test.wantReason):
+				t.Errorf("conditionFailure() = %v, want reason %s", failure, test.wantReason)
+			}
+		})
+	}
+}
+
+func TestContainerFailure(t *testing.T) {
+	waiting := func(reason string, restarts int32) corev1.ContainerStatus {
+		return corev1.ContainerStatus{
+			Name:         "controlplane",
+			RestartCount: restarts,
+			State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: reason}},
+		}
+	}
+	tests := []struct {
+		name       string
+		status     corev1.ContainerStatus
+		wantReason string
+	}{
+		{name: "running", status: corev1.ContainerStatus{State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}}},
+		{name: "creating", status: waiting("ContainerCreating", 0)},
+		{name: "image pull back-off", status: waiting("ImagePullBackOff", 0), wantReason: "ImagePullBackOff"},
+		{name: "invalid image name", status: waiting("InvalidImageName", 0), wantReason: "InvalidImageName"},
+		{name: "configuration error", status: waiting("CreateContainerConfigError", 0), wantReason: "CreateContainerConfigError"},
+		{name: "crash loop while dependencies start", status: waiting(ReasonCrashLoopBackOff, crashLoopRestartThreshold-1)},
+		{name: "crash loop", status: waiting(ReasonCrashLoopBackOff, crashLoopRestartThreshold), wantReason: ReasonCrashLoopBackOff},
+	}
+	deployment := deployment(1, nil, appsv1.DeploymentStatus{})
+	pod := corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "controlplane-abc"}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failure := containerFailure(deployment, pod, test.status)
+			switch {
+			case test.wantReason == "" && failure != nil:
+				t.Errorf("containerFailure() = %v, want none", failure)
+			case test.wantReason != "" && (failure == nil || failure.Reason != test.wantReason):
+				t.Errorf("containerFailure() = %v, want reason %s", failure, test.wantReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package kube
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+// todo: make configurable
+const (
+	leaseDuration = 15 * time.Second
+	renewDeadline = 10 * time.Second
+	retryPeriod   = 2 * time.Second
+)
+
+// RunAsLeader campaigns for the Lease namespace/name in the background and invokes run whenever this replica becomes
+// the leader. The context passed to run is cancelled when the leadership is lost, after which the replica campaigns
+// again until ctx is done.
+func RunAsLeader(ctx context.Context, config *rest.Config, namespace string, name string, run func(ctx context.Context)) error {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	identity := hostname + "_" + uuid.NewString()
+	lock, err := resourcelock.NewFromKubeconfig(resourcelock.LeasesResourceLock, namespace, name, resourcelock.ResourceLockConfig{Identity: identity}, config, renewDeadline)
+	if err != nil {
+		return err
+	}
+	electionConfig := leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            name,
+		LeaseDuration:   leaseDuration,
+		RenewDeadline:   renewDeadline,
+		RetryPeriod:     retryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				log.Println("Became the leader of", name)
+				run(ctx)
+			},
+			OnStoppedLeading: func() {
+				log.Println("No longer the leader of", name)
+			},
+			OnNewLeader: func(leader string) {
+				if leader != identity {
+					log.Println("The leader of", name, "is", leader)
+				}
+			},
+		},
+	}
+
+	go func() {
+		for ctx.Err() == nil {
+			elector, err := leaderelection.NewLeaderElector(electionConfig)
+			if err != nil {
+				log.Printf("leader election %s: %v\n", name, err)
+				return
+			}
+			// returns once the leadership is lost
+			elector.Run(ctx)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,135 @@
+package kube
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	toolscache "k8s.io/client-go/tools/cache"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ReadinessTracker watches the Deployments matching a label selector through a single shared informer. Waits for
+// deployment readiness wake up when a deployment changes, instead of polling the API server.
+type ReadinessTracker struct {
+	cache cache.Cache
+	// fallbackInterval re-checks deployments even without a change notification, in case one was missed
+	fallbackInterval time.Duration
+
+	mutex   sync.Mutex
+	waiters map[client.ObjectKey]map[chan struct{}]struct{}
+}
+
+// NewReadinessTracker creates a tracker for the Deployments matching the selector. The informer re-lists all of them
+// every resync interval.
+func NewReadinessTracker(config *rest.Config, scheme *runtime.Scheme, selector labels.Selector, resync time.Duration, fallbackInterval time.Duration) (*ReadinessTracker, error) {
+	deploymentCache, err := cache.New(config, cache.Options{
+		Scheme:     scheme,
+		SyncPeriod: &resync,
+		ByObject: map[client.Object]cache.ByObject{
+			&appsv1.Deployment{}: {Label: selector},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &ReadinessTracker{
+		cache:            deploymentCache,
+		fallbackInterval: fallbackInterval,
+		waiters:          map[client.ObjectKey]map[chan struct{}]struct{}{},
+	}, nil
+}
+
+// Start runs the informer in the background and returns once its cache is synced
+func (t *ReadinessTracker) Start(ctx context.Context) error {
+	informer, err := t.cache.GetInformer(ctx, &appsv1.Deployment{})
+	if err != nil {
+		return err
+	}
+	_, err = informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+		AddFunc:    t.notify,
+		UpdateFunc: func(_, object interface{}) { t.notify(object) },
+		DeleteFunc: t.notify,
+	})
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := t.cache.Start(ctx); err != nil {
+			log.Printf("readiness tracker stopped: %v\n", err)
+		}
+	}()
+	if !t.cache.WaitForCacheSync(ctx) {
+		return errors.New("readiness tracker cache did not sync")
+	}
+	log.Println("Started readiness tracker")
+	return nil
+}
+
+// Client returns a client whose deployment waits are woken up by the tracker. All requests go to the given client.
+func (t *ReadinessTracker) Client(c client.Client) client.Client {
+	return &trackedClient{Client: c, tracker: t}
+}
+
+// subscribe returns a channel that receives a value whenever the deployment changes, and a function to unsubscribe
+func (t *ReadinessTracker) subscribe(key client.ObjectKey) (<-chan struct{}, func()) {
+	changed := make(chan struct{}, 1)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.waiters[key] == nil {
+		t.waiters[key] = map[chan struct{}]struct{}{}
+	}
+	t.waiters[key][changed] = struct{}{}
+	return changed, func() {
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		delete(t.waiters[key], changed)
+		if len(t.waiters[key]) == 0 {
+			delete(t.waiters, key)
+		}
+	}
+}
+
+func (t *ReadinessTracker) notify(object interface{}) {
+	if tombstone, ok := object.(toolscache.DeletedFinalStateUnknown); ok {
+		object = tombstone.Obj
+	}
+	deployment, ok := object.(*appsv1.Deployment)
+	if !ok {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for changed := range t.waiters[client.ObjectKeyFromObject(deployment)] {
+		// a pending notification is sufficient, the waiter reads the latest state anyway
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+type trackedClient struct {
+	client.Client
+	tracker *ReadinessTracker
+}
+
+// deploymentChanges returns a channel that receives a value when the tracker of a tracked client notices a change of
+// the deployment, the interval in which the deployment is checked regardless, and a function to release the channel.
+// Failing pods do not change the deployment, so they are only looked for by the regular check.
+func deploymentChanges(c client.Client, key client.ObjectKey) (<-chan struct{}, time.Duration, func()) {
+	if tracked, ok := c.(*trackedClient); ok {
+		changed, unsubscribe := tracked.tracker.subscribe(key)
+		return changed, tracked.tracker.fallbackInterval, unsubscribe
+	}
+	// a nil channel never receives, so plain clients poll
+	return nil, readinessPollInterval, func() {}
+}
@@ -6,43 +6,50 @@ import (
 	"time"
 
 	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
 
 // todo: make configurable
 const readinessPollInterval = 2 * time.Second
 
-// WaitForDeploymentsAsync runs the readiness check in the background and invokes the callback on success.
+// WaitForDeploymentsAsync runs the readiness check in the background and invokes the callback with its result, which
+// is nil on success and usually a *ReadinessError otherwise.
 func WaitForDeploymentsAsync(
 	c client.Client,
 	ctx context.Context,
 	namespace string,
 	deployments []string,
-	callback func(),
+	callback func(error),
 ) {
 	log.Println("Waiting for deployments", deployments, "")
 	go func() {
-		if err := waitForDeployments(c, ctx, namespace, deployments); err != nil {
+		err := WaitForDeployments(c, ctx, namespace, deployments)
+		if err != nil {
 			log.Printf("deployment readiness check failed for namespace %s: %v\n", namespace, err)
-			return
 		}
-		callback()
+		callback(err)
 	}()
 }
 
-// waitForDeployments waits for all given deployments concurrently and returns an error if any fail.
-func waitForDeployments(c client.Client, ctx context.Context, namespace string, deployments []string) error {
+// WaitForDeployments waits for all given deployments concurrently and returns the first failure. The remaining waits
+// are stopped as soon as one deployment failed.
+func WaitForDeployments(c client.Client, ctx context.Context, namespace string, deployments []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 	errCh := make(chan error, len(deployments))
 	for _, name := range deployments {
 		name := name // capture
 		go func() {
-			errCh <- waitForDeployment(c, ctx, namespace, name)
+			errCh <- WaitForDeployment(c, ctx, namespace, name, 0)
 		}()
 	}
 	var firstErr error
 	for _, deployment := range deployments {
 		if err := <-errCh; err != nil && firstErr == nil {
 			firstErr = err
+			cancel()
 		} else if err == nil {
 			log.Println("Deployment", deployment, "ready")
 		}
@@ -50,21 +57,103 @@ func waitForDeployments(c client.Client, ctx context.Context, namespace string,
 	return firstErr
 }
 
-// waitForDeployment polls until the deployment reaches the desired ready replicas.
-func waitForDeployment(c client.Client, ctx context.Context, namespace string, name string) error {
+// WaitForDeployment waits until the deployment has rolled out all desired replicas of at least the given generation, or
+// until it failed. It is woken up by changes of the deployment if the client is tracked, and polls otherwise. The
+// deployment is always read from the API server, a cached copy may still show the previous generation right after an
+// apply.
+func WaitForDeployment(c client.Client, ctx context.Context, namespace string, name string, generation int64) error {
+	changed, interval, release := deploymentChanges(c, client.ObjectKey{Namespace: namespace, Name: name})
+	defer release()
+
 	deployment := &appsv1.Deployment{}
+	// the pods are only listed on the regular checks, a change of the deployment only needs its conditions checked
+	inspectPods := true
 	for {
 		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, deployment); err != nil {
-			return err
+			return waitError(c, ctx, namespace, name, err)
+		}
+
+		if deployment.Status.ObservedGeneration >= generation && DeploymentReady(deployment) {
+			return nil
+		}
+		failure := conditionFailure(deployment)
+		if failure == nil && inspectPods {
+			var err error
+			if failure, err = DeploymentFailure(c, ctx, deployment); err != nil {
+				return waitError(c, ctx, namespace, name, err)
+			}
+		}
+		if failure != nil {
+			return failure
 		}
 
-		desired := int32(1)
-		if deployment.Spec.Replicas != nil {
-			desired = *deployment.Spec.Replicas
+		select {
+		case <-ctx.Done():
+			return waitError(c, ctx, namespace, name, ctx.Err())
+		case <-changed:
+			inspectPods = false
+		case <-time.After(interval):
+			inspectPods = true
 		}
-		if deployment.Status.ReadyReplicas == desired {
+	}
+}
+
+// waitError replaces the error of a wait that ran out of time with a ReadinessError explaining the state of the deployment
+func waitError(c client.Client, ctx context.Context, namespace string, name string, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return TimeoutFailure(c, ctx, namespace, name)
+	}
+	return err
+}
+
+// ReadyDeployments checks the given deployments once, without waiting, and returns the names of those that are ready
+func ReadyDeployments(c client.Client, ctx context.Context, namespace string, deployments []string) ([]string, error) {
+	var ready []string
+	for _, name := range deployments {
+		deployment := &appsv1.Deployment{}
+		err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, deployment)
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if DeploymentReady(deployment) {
+			ready = append(ready, name)
+		}
+	}
+	return ready, nil
+}
+
+// DeploymentReady is true once the deployment controller has observed the current spec and all desired replicas are
+// updated, ready and available. Checking the ready replicas alone passes on the pods of the previous rollout.
+func DeploymentReady(deployment *appsv1.Deployment) bool {
+	desired := desiredReplicas(deployment)
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.Generation &&
+		status.UpdatedReplicas == desired &&
+		status.ReadyReplicas == desired &&
+		status.AvailableReplicas == desired
+}
+
+func desiredReplicas(deployment *appsv1.Deployment) int32 {
+	if deployment.Spec.Replicas != nil {
+		return *deployment.Spec.Replicas
+	}
+	return 1
+}
+
+// WaitForNamespaceDeleted polls until the namespace, including all objects in it, has been removed
+func WaitForNamespaceDeleted(c client.Client, ctx context.Context, name string) error {
+	namespace := &corev1.Namespace{}
+	for {
+		err := c.Get(ctx, client.ObjectKey{Name: name}, namespace)
+		if apierrors.IsNotFound(err) {
 			return nil
 		}
+		if err != nil {
+			return err
+		}
 
 		select {
 		case <-ctx.Done():
@@ -0,0 +1,76 @@
+package kube
+
+import (
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func deployment(generation int64, replicas *int32, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "controlplane", Generation: generation},
+		Spec:       appsv1.DeploymentSpec{Replicas: replicas},
+		Status:     status,
+	}
+}
+
+func replicas(count int32) *int32 {
+	return &count
+}
+
+func TestDeploymentReady(t *testing.T) {
+	tests := []struct {
+		name       string
+		deployment *appsv1.Deployment
+		want       bool
+	}{
+		{
+			name:       "rolled out",
+			deployment: deployment(2, replicas(3), appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 3}),
+			want:       true,
+		},
+		{
+			name:       "generation not observed yet",
+			deployment: deployment(3, replicas(3), appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 3}),
+			want:       false,
+		},
+		{
+			name:       "replicas of the previous rollout",
+			deployment: deployment(2, replicas(3), appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 1, ReadyReplicas: 3, AvailableReplicas: 3}),
+			want:       false,
+		},
+		{
+			name:       "old replicas still terminating",
+			deployment: deployment(2, replicas(3), appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 3, ReadyReplicas: 4, AvailableReplicas: 4}),
+			want:       false,
+		},
+		{
+			name:       "ready but not available",
+			deployment: deployment(2, replicas(3), appsv1.DeploymentStatus{ObservedGeneration: 2, UpdatedReplicas: 3, ReadyReplicas: 3, AvailableReplicas: 2}),
+			want:       false,
+		},
+		{
+			name:       "one replica by default",
+			deployment: deployment(1, nil, appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}),
+			want:       true,
+		},
+		{
+			name:       "scaled to zero",
+			deployment: deployment(4, replicas(0), appsv1.DeploymentStatus{ObservedGeneration: 4}),
+			want:       true,
+		},
+		{
+			name:       "scaling down",
+			deployment: deployment(4, replicas(0), appsv1.DeploymentStatus{ObservedGeneration: 4, ReadyReplicas: 1, AvailableReplicas: 1}),
+			want:       false,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := DeploymentReady(test.deployment); got != test.want {
+				t.Errorf("DeploymentReady() = %t, want %t", got, test.want)
+			}
+		})
+	}
+}
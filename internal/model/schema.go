@@ -0,0 +1,74 @@
+package model
+
+import (
+	"reflect"
+	"strings"
+)
+
+// ruleSchemas are the JSON Schema keywords equivalent to the validators of the `validate` tag rules
+var ruleSchemas = map[string]map[string]interface{}{
+	"dns1123label": {"pattern": "^[a-z0-9]([-a-z0-9]*[a-z0-9])?$", "maxLength": 63},
+	"hostname":     {"pattern": `^[a-z0-9]([-a-z0-9.]*[a-z0-9])?(:[0-9]{1,5})?$`},
+	"didweb":       {"pattern": "^did:web:[^:]+(:[^:]+)*$"},
+}
+
+// Schema derives a JSON Schema from the JSON encoding of a struct. Fields list their `validate` tag rules as schema
+// keywords and their `description` tag as description, so that clients see the constraints that Validate enforces.
+func Schema(value interface{}) map[string]interface{} {
+	schema := typeSchema(reflect.TypeOf(value))
+	schema["$schema"] = "http://json-schema.org/draft-07/schema#"
+	return schema
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return typeSchema(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		return structSchema(t)
+	default:
+		return map[string]interface{}{}
+	}
+}
+
+func structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := fieldName(field)
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		property := typeSchema(field.Type)
+		if description := field.Tag.Get("description"); description != "" {
+			property["description"] = description
+		}
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			if rule == "required" {
+				required = append(required, name)
+			}
+			for keyword, value := range ruleSchemas[rule] {
+				property[keyword] = value
+			}
+		}
+		properties[name] = property
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,119 @@
+package model
+
+import (
+	"reflect"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+func TestTypeSchema(t *testing.T) {
+	type nested struct {
+		Name     string `json:"name" validate:"required"`
+		internal string
+		Ignored  string `json:"-"`
+	}
+	tests := []struct {
+		name  string
+		value interface{}
+		want  map[string]interface{}
+	}{
+		{name: "string", value: "", want: map[string]interface{}{"type": "string"}},
+		{name: "bool", value: false, want: map[string]interface{}{"type": "boolean"}},
+		{name: "int32", value: int32(0), want: map[string]interface{}{"type": "integer"}},
+		{name: "float", value: 0.0, want: map[string]interface{}{"type": "number"}},
+		{name: "pointer", value: new(int), want: map[string]interface{}{"type": "integer"}},
+		{
+			name:  "slice",
+			value: []string{},
+			want:  map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}},
+		},
+		{
+			name:  "map",
+			value: map[string]bool{},
+			want:  map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "boolean"}},
+		},
+		{
+			name:  "struct",
+			value: nested{},
+			want: map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"name": map[string]interface{}{"type": "string"}},
+				"required":   []string{"name"},
+			},
+		},
+		{name: "unsupported", value: make(chan int), want: map[string]interface{}{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := typeSchema(reflect.TypeOf(test.value)); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("typeSchema() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSchemaOfServiceProperties(t *testing.T) {
+	schema := Schema(ServiceProperties{})
+	if schema["$schema"] != "http://json-schema.org/draft-07/schema#" {
+		t.Errorf("$schema = %v", schema["$schema"])
+	}
+	if required := schema["required"]; !reflect.DeepEqual(required, []string{"participantName", "participantDid", "kubeHost"}) {
+		t.Errorf("required = %v", required)
+	}
+	properties := schema["properties"].(map[string]interface{})
+	tests := []struct {
+		property    string
+		rule        string
+		description bool
+	}{
+		{property: "participantName", rule: "dns1123label", description: true},
+		{property: "participantDid", rule: "didweb", description: true},
+		{property: "kubeHost", rule: "hostname", description: true},
+		{property: "profile", description: true},
+		{property: "components", description: true},
+	}
+	for _, test := range tests {
+		t.Run(test.property, func(t *testing.T) {
+			property, ok := properties[test.property].(map[string]interface{})
+			if !ok {
+				t.Fatalf("property %s is missing", test.property)
+			}
+			if _, found := property["description"]; found != test.description {
+				t.Errorf("description = %v, want one: %t", property["description"], test.description)
+			}
+			if test.rule != "" && property["pattern"] != ruleSchemas[test.rule]["pattern"] {
+				t.Errorf("pattern = %v, want the one of rule %s", property["pattern"], test.rule)
+			}
+		})
+	}
+}
+
+func TestRuleSchemas(t *testing.T) {
+	// every rule that Validate enforces is described in the schema
+	for rule := range validators {
+		if _, found := ruleSchemas[rule]; !found {
+			t.Errorf("rule %s has no schema", rule)
+		}
+	}
+	// values that both the validator and the schema accept
+	accepted := map[string][]string{
+		"dns1123label": {"alice", "participant-1"},
+		"hostname":     {"localhost", "edc.example.com", "edc.example.com:8080"},
+		"didweb":       {"did:web:example.com", "did:web:example.com%3A8080:alice"},
+	}
+	for rule, values := range accepted {
+		pattern := regexp.MustCompile(ruleSchemas[rule]["pattern"].(string))
+		for _, value := range values {
+			if !pattern.MatchString(value) {
+				t.Errorf("schema of rule %s rejects %q", rule, value)
+			}
+			if problems := validators[rule](value); len(problems) > 0 {
+				t.Errorf("validator of rule %s rejects %q: %v", rule, value, problems)
+			}
+		}
+	}
+	if !slices.Contains(Schema(AgentConfiguration{})["required"].([]string), "profiles") {
+		t.Error("profiles of the agent configuration are not required")
+	}
+}
@@ -3,10 +3,125 @@ package model
 import "time"
 
 type ParticipantDefinition struct {
-	ParticipantName       string `json:"participantName,omitempty" validate:"required"`
-	Did                   string `json:"did,omitempty" validate:"required"`
-	KubernetesIngressHost string `json:"kubeHost,omitempty"`
+	ParticipantName       string                        `json:"participantName,omitempty" validate:"required,dns1123label"`
+	Did                   string                        `json:"did,omitempty" validate:"required,didweb"`
+	KubernetesIngressHost string                        `json:"kubeHost,omitempty" validate:"hostname"`
+	Profile               string                        `json:"profile,omitempty"`
+	Components            map[string]ComponentOverrides `json:"components,omitempty"`
+	// Stopped scales all workloads of the participant to zero, its data and configuration are kept
+	Stopped bool `json:"stopped,omitempty"`
 }
+
+// Validate checks the definition against the rules of its `validate` tags
+func (d ParticipantDefinition) Validate() error {
+	return Validate(d)
+}
+
+// ServiceProperties are the properties of a Fulcrum service that a participant is provisioned for
+type ServiceProperties struct {
+	ParticipantName string                        `json:"participantName" validate:"required,dns1123label" description:"Name of the participant and of its namespace"`
+	ParticipantDid  string                        `json:"participantDid" validate:"required,didweb" description:"did:web identifier of the participant"`
+	KubeHost        string                        `json:"kubeHost" validate:"required,hostname" description:"Host of the ingress through which the participant is reachable"`
+	Profile         string                        `json:"profile,omitempty" description:"Profile to provision, defaults to the profile of the service type"`
+	Components      map[string]ComponentOverrides `json:"components,omitempty" description:"Overrides of the cluster-wide defaults per component, e.g. controlplane"`
+}
+
+// AgentConfiguration is the configuration of the Fulcrum agent that represents the provisioner
+type AgentConfiguration struct {
+	Profiles []string `json:"profiles" validate:"required" description:"Profiles of the participants the agent provisions"`
+}
+
+// ComponentOverrides customizes a single component (e.g. "controlplane") of a participant deployment. Everything that
+// is not set falls back to the cluster-wide defaults.
+type ComponentOverrides struct {
+	Image           string                `json:"image,omitempty"`
+	ImagePullPolicy string                `json:"imagePullPolicy,omitempty"`
+	Replicas        *int32                `json:"replicas,omitempty"`
+	Resources       *ResourceRequirements `json:"resources,omitempty"`
+}
+
+type ResourceRequirements struct {
+	Requests ResourceList `json:"requests,omitempty"`
+	Limits   ResourceList `json:"limits,omitempty"`
+}
+
+type ResourceList struct {
+	Cpu    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"`
+}
+
+// ObjectChange describes how an operation would change a single Kubernetes object
+type ObjectChange struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	Operation string `json:"operation"`
+	Diff      string `json:"diff,omitempty"`
+}
+
+// UpgradeRequest configures a bulk upgrade of provisioned participants to the current templates
+type UpgradeRequest struct {
+	// Participants limits the upgrade to the given participants, all provisioned participants are upgraded if empty
+	Participants []string `json:"participants,omitempty"`
+	// Concurrency is the number of participants that are upgraded at the same time
+	Concurrency int `json:"concurrency,omitempty"`
+	// CanarySize participants are upgraded first, the remaining ones only if all of them succeeded
+	CanarySize int `json:"canarySize,omitempty"`
+	// ContinueOnFailure keeps upgrading the remaining participants after a failure outside the canary batch
+	ContinueOnFailure bool `json:"continueOnFailure,omitempty"`
+	// ReadinessTimeoutSeconds is how long each participant may take to become ready again, zero uses the readiness
+	// timeout of its profile
+	ReadinessTimeoutSeconds int `json:"readinessTimeoutSeconds,omitempty"`
+}
+
+// UpgradeStatus reports the progress of a bulk upgrade
+type UpgradeStatus struct {
+	Id           string               `json:"id"`
+	State        string               `json:"state"`
+	Request      UpgradeRequest       `json:"request"`
+	StartedAt    time.Time            `json:"startedAt"`
+	FinishedAt   *time.Time           `json:"finishedAt,omitempty"`
+	Total        int                  `json:"total"`
+	Succeeded    int                  `json:"succeeded"`
+	Failed       int                  `json:"failed"`
+	Skipped      int                  `json:"skipped"`
+	Participants []ParticipantUpgrade `json:"participants"`
+}
+
+// ParticipantUpgrade is the upgrade progress of a single participant
+type ParticipantUpgrade struct {
+	Name         string `json:"name"`
+	Canary       bool   `json:"canary,omitempty"`
+	FromRevision string `json:"fromRevision,omitempty"`
+	State        string `json:"state"`
+	// Reason is the cause reported by the readiness check if the participant did not become ready
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// RollbackStatus reports the progress of the rollback of a participant
+type RollbackStatus struct {
+	Participant string `json:"participant"`
+	// Version is the requested version of the history, 0 selects the version before the latest one
+	Version    int        `json:"version"`
+	State      string     `json:"state"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Resources are the applied objects, once the rollback succeeded
+	Resources []AppliedObject `json:"resources,omitempty"`
+	// Reason is the cause reported by the readiness check if the participant did not become ready
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// ManifestRevision is an entry of the manifest history of a participant
+type ManifestRevision struct {
+	Version          int                   `json:"version"`
+	TemplateRevision string                `json:"templateRevision,omitempty"`
+	AppliedAt        time.Time             `json:"appliedAt"`
+	Definition       ParticipantDefinition `json:"definition"`
+}
+
 type PendingJob struct {
 	Id         string                 `json:"id"`
 	ProviderId string                 `json:"providerId"`
@@ -34,6 +149,38 @@ type PendingJob struct {
 	} `json:"service"`
 }
 
+// JobResult is reported to Fulcrum Core when a job completes
+type JobResult struct {
+	// ExternalId identifies the provisioned participant, it is the same for every job of the participant
+	ExternalId string               `json:"externalId"`
+	Resources  ProvisionedResources `json:"resources"`
+}
+
+// ProvisionedResources describes what was deployed for a participant
+type ProvisionedResources struct {
+	Namespace string `json:"namespace,omitempty"`
+	// Objects are the applied objects, in apply order
+	Objects             []AppliedObject       `json:"objects,omitempty"`
+	Endpoints           *ParticipantEndpoints `json:"endpoints,omitempty"`
+	IdentityHubClientId string                `json:"identityHubClientId,omitempty"`
+}
+
+// AppliedObject identifies an object that was applied for a participant. Objects of different kinds may share a name.
+type AppliedObject struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Generation is the generation the API server returned for the applied object, it is not reported
+	Generation int64 `json:"-"`
+}
+
+// ParticipantEndpoints are the public URLs of a participant's APIs
+type ParticipantEndpoints struct {
+	Management string `json:"management,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	Did        string `json:"did,omitempty"`
+	Catalog    string `json:"catalog,omitempty"`
+}
+
 type ParticipantData struct {
 	Id        string    `json:"id"`
 	Name      string    `json:"name"`
@@ -43,6 +190,8 @@ type ParticipantData struct {
 }
 
 type AgentData struct {
+	// Id is only set for agents read from Fulcrum Core
+	Id            string                 `json:"id,omitempty"`
 	Name          string                 `json:"name"`
 	ProviderId    string                 `json:"providerId"`
 	AgentTypeId   string                 `json:"agentTypeId"`
@@ -51,6 +200,34 @@ type AgentData struct {
 	Participant   ParticipantData        `json:"participant,omitempty"`
 }
 
+// ServiceTypeData is a service type registered in Fulcrum Core
+type ServiceTypeData struct {
+	Id             string                 `json:"id"`
+	Name           string                 `json:"name"`
+	PropertySchema map[string]interface{} `json:"propertySchema,omitempty"`
+}
+
+// AgentTypeData is an agent type registered in Fulcrum Core
+type AgentTypeData struct {
+	Id                  string                 `json:"id"`
+	Name                string                 `json:"name"`
+	ServiceTypes        []ServiceTypeData      `json:"serviceTypes"`
+	ConfigurationSchema map[string]interface{} `json:"configurationSchema,omitempty"`
+}
+
+// ServiceGroupData is a service group registered in Fulcrum Core
+type ServiceGroupData struct {
+	Id         string `json:"id"`
+	Name       string `json:"name"`
+	ConsumerId string `json:"consumerId"`
+}
+
+// ListResponse is a page of a list returned by Fulcrum Core
+type ListResponse[T any] struct {
+	Items   []T  `json:"items"`
+	HasNext bool `json:"hasNext"`
+}
+
 type TokenInformation struct {
 	Id            string    `json:"id"`
 	Name          string    `json:"name"`
@@ -0,0 +1,142 @@
+package model
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// validators of the rules a `validate` tag can list besides "required". They return the problems of a non-empty
+// value, empty values are only rejected by "required".
+var validators = map[string]func(value string) []string{
+	"dns1123label": validation.IsDNS1123Label,
+	"hostname":     validateHostname,
+	"didweb":       validateDidWeb,
+}
+
+// rules are checked for every type with `validate` tags when the package is loaded, so that an unknown rule fails at
+// startup rather than when the first value is validated
+func init() {
+	for _, value := range []interface{}{ParticipantDefinition{}, ServiceProperties{}, AgentConfiguration{}} {
+		if err := checkRules(reflect.TypeOf(value)); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// checkRules returns an error if a `validate` tag of the struct type lists an unknown rule
+func checkRules(t reflect.Type) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		for _, rule := range strings.Split(tag, ",") {
+			if _, ok := validators[rule]; !ok && rule != "required" {
+				return fmt.Errorf("field %s of %s: unknown validation rule %q", field.Name, t.Name(), rule)
+			}
+		}
+	}
+	return nil
+}
+
+// ValidationError lists all fields of a value that violate the rules of their `validate` tags
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "validation failed: " + strings.Join(e.Problems, "; ")
+}
+
+// Validate checks the fields of a struct against the comma-separated rules of their `validate` tags, e.g.
+// `validate:"required,dns1123label"`. Fields are named after their JSON names in the returned *ValidationError. Tags
+// with unknown rules are reported as a plain error.
+func Validate(value interface{}) error {
+	v := reflect.Indirect(reflect.ValueOf(value))
+	t := v.Type()
+	if err := checkRules(t); err != nil {
+		return err
+	}
+	var problems []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+		name := fieldName(field)
+		fieldValue := v.Field(i)
+		for _, rule := range strings.Split(tag, ",") {
+			if rule == "required" {
+				if fieldValue.IsZero() {
+					problems = append(problems, name+": is required")
+				}
+				continue
+			}
+			validator := validators[rule]
+			if fieldValue.Kind() != reflect.String || fieldValue.String() == "" {
+				continue
+			}
+			for _, problem := range validator(fieldValue.String()) {
+				problems = append(problems, fmt.Sprintf("%s: %q: %s", name, fieldValue.String(), problem))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// validateHostname accepts a DNS name or an IP address, optionally followed by a port
+func validateHostname(value string) []string {
+	host := value
+	if h, port, err := net.SplitHostPort(value); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return []string{"must have a port between 1 and 65535"}
+		}
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+	if len(validation.IsDNS1123Subdomain(host)) > 0 {
+		return []string{"must be a lower case DNS name or an IP address, optionally with a port"}
+	}
+	return nil
+}
+
+// validateDidWeb accepts did:web identifiers, i.e. "did:web:" followed by a host with an optional percent-encoded port
+// and optional path segments separated by colons, e.g. "did:web:example.com%3A8080:participants:alice"
+func validateDidWeb(value string) []string {
+	const prefix = "did:web:"
+	if !strings.HasPrefix(value, prefix) {
+		return []string{"must start with " + prefix}
+	}
+	segments := strings.Split(strings.TrimPrefix(value, prefix), ":")
+	host, err := url.PathUnescape(segments[0])
+	if err != nil || host == "" || len(validateHostname(host)) > 0 {
+		return []string{"must name a valid host after " + prefix}
+	}
+	for _, segment := range segments[1:] {
+		if segment == "" {
+			return []string{"must not contain empty path segments"}
+		}
+	}
+	return nil
+}
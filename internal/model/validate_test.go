@@ -0,0 +1,142 @@
+package model
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := ParticipantDefinition{ParticipantName: "alice", Did: "did:web:example.com:alice", KubernetesIngressHost: "edc.example.com"}
+	tests := []struct {
+		name  string
+		value interface{}
+		// wantProblems are the beginnings of the expected problems, nil if the value is valid
+		wantProblems []string
+	}{
+		{
+			name:  "valid definition",
+			value: valid,
+		},
+		{
+			name:  "pointer to a valid definition",
+			value: &valid,
+		},
+		{
+			name:  "optional host may be empty",
+			value: ParticipantDefinition{ParticipantName: "alice", Did: "did:web:example.com"},
+		},
+		{
+			name:         "missing required fields",
+			value:        ParticipantDefinition{},
+			wantProblems: []string{"participantName: is required", "did: is required"},
+		},
+		{
+			name:  "malformed fields",
+			value: ParticipantDefinition{ParticipantName: "Alice", Did: "did:key:alice", KubernetesIngressHost: "edc.example.com:0"},
+			wantProblems: []string{
+				`participantName: "Alice": a lowercase RFC 1123 label`,
+				`did: "did:key:alice": must start with did:web:`,
+				`kubeHost: "edc.example.com:0": must have a port between 1 and 65535`,
+			},
+		},
+		{
+			name:         "service properties require a host",
+			value:        ServiceProperties{ParticipantName: "alice", ParticipantDid: "did:web:example.com"},
+			wantProblems: []string{"kubeHost: is required"},
+		},
+		{
+			name:         "agent configuration requires profiles",
+			value:        AgentConfiguration{},
+			wantProblems: []string{"profiles: is required"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := Validate(test.value)
+			if test.wantProblems == nil {
+				if err != nil {
+					t.Fatalf("Validate() = %v, want no error", err)
+				}
+				return
+			}
+			var validationError *ValidationError
+			if !errors.As(err, &validationError) {
+				t.Fatalf("Validate() = %v, want a *ValidationError", err)
+			}
+			// the messages of the Kubernetes validators are only compared by their beginning
+			if !slices.EqualFunc(validationError.Problems, test.wantProblems, strings.HasPrefix) {
+				t.Errorf("Validate() problems = %q, want %q", validationError.Problems, test.wantProblems)
+			}
+		})
+	}
+}
+
+func TestValidateUnknownRule(t *testing.T) {
+	value := struct {
+		Name string `json:"name" validate:"required,unknown"`
+	}{Name: "alice"}
+	err := Validate(value)
+	if err == nil {
+		t.Fatal("Validate() = nil, want an error for the unknown rule")
+	}
+	var validationError *ValidationError
+	if errors.As(err, &validationError) {
+		t.Errorf("Validate() = %v, want a plain error instead of a *ValidationError", err)
+	}
+}
+
+func TestValidateHostname(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{value: "localhost", valid: true},
+		{value: "edc.example.com", valid: true},
+		{value: "edc.example.com:8080", valid: true},
+		{value: "10.0.0.1", valid: true},
+		{value: "10.0.0.1:443", valid: true},
+		{value: "[::1]:443", valid: true},
+		{value: "EDC.example.com", valid: false},
+		{value: "edc.example.com:0", valid: false},
+		{value: "edc.example.com:65536", valid: false},
+		{value: "edc.example.com:http", valid: false},
+		{value: "http://edc.example.com", valid: false},
+		{value: "edc_example.com", valid: false},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			problems := validateHostname(test.value)
+			if valid := len(problems) == 0; valid != test.valid {
+				t.Errorf("validateHostname(%q) = %q, want valid = %t", test.value, problems, test.valid)
+			}
+		})
+	}
+}
+
+func TestValidateDidWeb(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{value: "did:web:example.com", valid: true},
+		{value: "did:web:example.com%3A8080", valid: true},
+		{value: "did:web:example.com:participants:alice", valid: true},
+		{value: "did:web:localhost%3A7083:alice", valid: true},
+		{value: "did:key:z6Mkf", valid: false},
+		{value: "did:web:", valid: false},
+		{value: "did:web:example.com::alice", valid: false},
+		{value: "did:web:example.com:alice:", valid: false},
+		{value: "did:web:Example.com", valid: false},
+		{value: "did:web:example.com%3", valid: false},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			problems := validateDidWeb(test.value)
+			if valid := len(problems) == 0; valid != test.valid {
+				t.Errorf("validateDidWeb(%q) = %q, want valid = %t", test.value, problems, test.valid)
+			}
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package provisioner
+
+import (
+	"k8s-provisioner/internal/model"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// backend is a port of a service that an ingress path routes to
+type backend struct {
+	service string
+	port    int64
+}
+
+// endpoint is a public API of a participant, reached through the ingress path of its backend
+type endpoint struct {
+	// path of the API below the ingress path
+	path string
+	set  func(endpoints *model.ParticipantEndpoints, url string)
+}
+
+// endpoints maps the backends of the reported APIs to the endpoints they serve. The embedded templates do not expose
+// the protocol API publicly, it is only reported for templates that do.
+func endpoints(values TemplateValues) map[backend]endpoint {
+	return map[backend]endpoint{
+		{"controlplane", int64(values.ControlPlane.ManagementPort)}: {"/api/management", func(e *model.ParticipantEndpoints, url string) { e.Management = url }},
+		{"controlplane", int64(values.ControlPlane.ProtocolPort)}:   {"/api/dsp", func(e *model.ParticipantEndpoints, url string) { e.Protocol = url }},
+		{"controlplane", int64(values.ControlPlane.CatalogPort)}:    {"/api/catalog", func(e *model.ParticipantEndpoints, url string) { e.Catalog = url }},
+		{"identityhub", int64(values.IdentityHub.DidPort)}:          {"/did.json", func(e *model.ParticipantEndpoints, url string) { e.Did = url }},
+	}
+}
+
+// Describe reports the namespace of the participant and derives the public URLs of its APIs from the paths of the
+// ingresses of its templates. APIs that no ingress exposes are left empty. The applied objects are only known to the
+// caller that applied them.
+func (p ProvisioningAgentImpl) Describe(definition model.ParticipantDefinition) (model.ProvisionedResources, error) {
+	profile, err := LookupProfile(definition.Profile)
+	if err != nil {
+		return model.ProvisionedResources{}, err
+	}
+	values, err := p.templateValues(definition, profile)
+	if err != nil {
+		return model.ProvisionedResources{}, err
+	}
+	objects, err := p.renderObjects(definition, profile)
+	if err != nil {
+		return model.ProvisionedResources{}, err
+	}
+
+	resources := model.ProvisionedResources{
+		Namespace: values.Participant.Namespace,
+		Endpoints: ingressEndpoints(definition, values, objects),
+	}
+	if profile.Includes(ComponentIdentityHub) {
+		// the templates register the STS client of the participant under its DID
+		resources.IdentityHubClientId = values.Participant.Id
+	}
+	return resources, nil
+}
+
+func ingressEndpoints(definition model.ParticipantDefinition, values TemplateValues, objects []*unstructured.Unstructured) *model.ParticipantEndpoints {
+	apis := endpoints(values)
+	result := &model.ParticipantEndpoints{}
+	for _, obj := range objects {
+		if obj.GetKind() != "Ingress" {
+			continue
+		}
+		scheme := "http://"
+		if tls, found, _ := unstructured.NestedSlice(obj.Object, "spec", "tls"); found && len(tls) > 0 {
+			scheme = "https://"
+		}
+		rules, _, _ := unstructured.NestedSlice(obj.Object, "spec", "rules")
+		for _, rule := range rules {
+			rule, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			host, _, _ := unstructured.NestedString(rule, "host")
+			if host == "" {
+				host = definition.KubernetesIngressHost
+			}
+			paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+			for _, path := range paths {
+				path, ok := path.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				service, _, _ := unstructured.NestedString(path, "backend", "service", "name")
+				port, _, _ := unstructured.NestedInt64(path, "backend", "service", "port", "number")
+				api, found := apis[backend{service, port}]
+				if !found {
+					continue
+				}
+				prefix, _, _ := unstructured.NestedString(path, "path")
+				api.set(result, scheme+host+pathPrefix(prefix)+api.path)
+			}
+		}
+	}
+	return result
+}
+
+// pathPrefix returns the literal prefix of an ingress path, without the capture groups of a regular expression like
+// /name/cp(/|$)(.*)
+func pathPrefix(path string) string {
+	if i := strings.Index(path, "("); i >= 0 {
+		path = path[:i]
+	}
+	return strings.TrimSuffix(path, "/")
+}
@@ -0,0 +1,125 @@
+package provisioner
+
+import (
+	"k8s-provisioner/internal/model"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestPathPrefix(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/alice/cp(/|$)(.*)", want: "/alice/cp"},
+		{path: "/alice/cp/(.*)", want: "/alice/cp"},
+		{path: "/alice/ih", want: "/alice/ih"},
+		{path: "/alice/", want: "/alice"},
+		{path: "/", want: ""},
+		{path: "", want: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.path, func(t *testing.T) {
+			if got := pathPrefix(test.path); got != test.want {
+				t.Errorf("pathPrefix(%q) = %q, want %q", test.path, got, test.want)
+			}
+		})
+	}
+}
+
+// ingressPath is a path of an ingress rule that routes to a port of a service
+type ingressPath struct {
+	path    string
+	service string
+	port    int64
+}
+
+func ingress(host string, tls bool, paths ...ingressPath) *unstructured.Unstructured {
+	var httpPaths []interface{}
+	for _, path := range paths {
+		httpPaths = append(httpPaths, map[string]interface{}{
+			"path": path.path,
+			"backend": map[string]interface{}{
+				"service": map[string]interface{}{
+					"name": path.service,
+					"port": map[string]interface{}{"number": path.port},
+				},
+			},
+		})
+	}
+	rule := map[string]interface{}{"http": map[string]interface{}{"paths": httpPaths}}
+	if host != "" {
+		rule["host"] = host
+	}
+	spec := map[string]interface{}{"rules": []interface{}{rule}}
+	if tls {
+		spec["tls"] = []interface{}{map[string]interface{}{"hosts": []interface{}{host}}}
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "networking.k8s.io/v1",
+		"kind":       "Ingress",
+		"metadata":   map[string]interface{}{"name": "ingress"},
+		"spec":       spec,
+	}}
+}
+
+func TestIngressEndpoints(t *testing.T) {
+	values := DefaultTemplateValues()
+	managementPort := int64(values.ControlPlane.ManagementPort)
+	catalogPort := int64(values.ControlPlane.CatalogPort)
+	didPort := int64(values.IdentityHub.DidPort)
+	definition := model.ParticipantDefinition{ParticipantName: "alice", KubernetesIngressHost: "edc.example.com"}
+
+	tests := []struct {
+		name    string
+		objects []*unstructured.Unstructured
+		want    model.ParticipantEndpoints
+	}{
+		{
+			name: "regular expression paths on the participant host",
+			objects: []*unstructured.Unstructured{
+				ingress("", false,
+					ingressPath{path: "/alice/cp(/|$)(.*)", service: "controlplane", port: managementPort},
+					ingressPath{path: "/alice/catalog(/|$)(.*)", service: "controlplane", port: catalogPort},
+				),
+				ingress("", false, ingressPath{path: "/alice/ih(/|$)(.*)", service: "identityhub", port: didPort}),
+			},
+			want: model.ParticipantEndpoints{
+				Management: "http://edc.example.com/alice/cp/api/management",
+				Catalog:    "http://edc.example.com/alice/catalog/api/catalog",
+				Did:        "http://edc.example.com/alice/ih/did.json",
+			},
+		},
+		{
+			name: "host and tls of the ingress",
+			objects: []*unstructured.Unstructured{
+				ingress("alice.example.com", true, ingressPath{path: "/", service: "controlplane", port: managementPort}),
+			},
+			want: model.ParticipantEndpoints{Management: "https://alice.example.com/api/management"},
+		},
+		{
+			name: "unknown backends are ignored",
+			objects: []*unstructured.Unstructured{
+				ingress("", false,
+					ingressPath{path: "/alice/dp", service: "dataplane", port: managementPort},
+					ingressPath{path: "/alice/cp", service: "controlplane", port: 1},
+				),
+			},
+			want: model.ParticipantEndpoints{},
+		},
+		{
+			name:    "no ingress",
+			objects: nil,
+			want:    model.ParticipantEndpoints{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ingressEndpoints(definition, values, test.objects)
+			if *got != test.want {
+				t.Errorf("ingressEndpoints() = %+v, want %+v", *got, test.want)
+			}
+		})
+	}
+}
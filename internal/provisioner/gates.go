@@ -0,0 +1,78 @@
+package provisioner
+
+import (
+	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/readiness"
+	"log"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ReadinessGates returns the gates that must pass before the participant is ready: a rollout or endpoint check for
+// every workload and service of its templates, an address check for every ingress if enabled, and the health checks of
+// its profile
+func (p ProvisioningAgentImpl) ReadinessGates(definition model.ParticipantDefinition) ([]readiness.Gate, error) {
+	profile, err := LookupProfile(definition.Profile)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := p.renderObjects(definition, profile)
+	if err != nil {
+		return nil, err
+	}
+	sortForApply(objects)
+	return p.readinessGates(definition, profile, objects), nil
+}
+
+// workloadKinds are the kinds whose replicas are scaled to zero while a participant is stopped
+var workloadKinds = map[string]bool{
+	"Deployment":  true,
+	"StatefulSet": true,
+}
+
+// readinessGates builds the gates for the objects. Objects that were just applied carry the generation returned by the
+// API server, so their rollout must have observed it; rendered objects have none and are checked against the live one.
+func (p ProvisioningAgentImpl) readinessGates(definition model.ParticipantDefinition, profile Profile, objects []*unstructured.Unstructured) []readiness.Gate {
+	// only deployment waits are driven by the tracker, all other requests go to the API server directly
+	deploymentClient := p.kubeClient
+	if p.config.ReadinessTracker != nil {
+		deploymentClient = p.config.ReadinessTracker.Client(p.kubeClient)
+	}
+	var gates []readiness.Gate
+	for _, obj := range objects {
+		namespace, name := obj.GetNamespace(), obj.GetName()
+		if definition.Stopped && !workloadKinds[obj.GetKind()] {
+			// a stopped participant has no endpoints, it is ready once its workloads are scaled down
+			continue
+		}
+		switch obj.GetKind() {
+		case "Deployment":
+			gates = append(gates, readiness.DeploymentGate{Client: deploymentClient, Namespace: namespace, Deployment: name, Generation: obj.GetGeneration()})
+		case "StatefulSet":
+			gates = append(gates, readiness.StatefulSetGate{Client: p.kubeClient, Namespace: namespace, StatefulSet: name, Generation: obj.GetGeneration()})
+		case "Service":
+			// services without a selector have their endpoints managed by someone else
+			if selector, found, _ := unstructured.NestedMap(obj.Object, "spec", "selector"); found && len(selector) > 0 {
+				gates = append(gates, readiness.ServiceEndpointsGate{Client: p.kubeClient, Namespace: namespace, Service: name})
+			}
+		case "Ingress":
+			if p.config.IngressAddressGates {
+				gates = append(gates, readiness.IngressAddressGate{Client: p.kubeClient, Namespace: namespace, Ingress: name})
+			}
+		}
+	}
+	if definition.Stopped {
+		return gates
+	}
+	if definition.KubernetesIngressHost == "" {
+		// the health checks are only reachable through the ingress host, without one they could never pass
+		if len(profile.HealthChecks) > 0 {
+			log.Printf("Skipping %d health checks of participant %s, it has no ingress host\n", len(profile.HealthChecks), definition.ParticipantName)
+		}
+		return gates
+	}
+	for _, path := range profile.HealthChecks {
+		gates = append(gates, readiness.HTTPGate{URL: "http://" + definition.KubernetesIngressHost + "/" + definition.ParticipantName + path})
+	}
+	return gates
+}
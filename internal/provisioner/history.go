@@ -0,0 +1,263 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/readiness"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// labels of the Secrets that hold the manifest history. History Secrets deliberately lack LabelParticipant, so they are
+// never pruned.
+const (
+	LabelHistoryOf      = "provisioner.fulcrum.io/history-of"
+	LabelHistoryVersion = "provisioner.fulcrum.io/history-version"
+)
+
+// keys of a history Secret
+const (
+	historyManifestKey   = "manifest"
+	historyDefinitionKey = "definition"
+	historyAppliedAtKey  = "appliedAt"
+)
+
+const historySecretPrefix = "provisioner-history-v"
+
+// manifest is the complete set of objects applied for a participant, in apply order
+type manifest []*unstructured.Unstructured
+
+// History returns the manifests applied for the participant, the latest first
+func (p ProvisioningAgentImpl) History(participantName string) ([]model.ManifestRevision, error) {
+	secrets, err := p.historySecrets(participantName)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]model.ManifestRevision, 0, len(secrets))
+	for i := len(secrets) - 1; i >= 0; i-- {
+		revision, err := manifestRevision(secrets[i])
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, nil
+}
+
+// RollbackResources applies the manifest of an earlier version again, 0 selects the version before the latest one. The
+// rollback is recorded as a new version, and the call returns once the deployments of the participant are ready.
+func (p ProvisioningAgentImpl) RollbackResources(participantName string, version int) ([]model.AppliedObject, error) {
+	secrets, err := p.historySecrets(participantName)
+	if err != nil {
+		return nil, err
+	}
+	target, err := selectVersion(secrets, version)
+	if err != nil {
+		return nil, fmt.Errorf("participant %s: %w", participantName, err)
+	}
+	revision, err := manifestRevision(target)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := decodeManifest(target.Data[historyManifestKey])
+	if err != nil {
+		return nil, fmt.Errorf("history version %d: %w", revision.Version, err)
+	}
+	profile, err := LookupProfile(revision.Definition.Profile)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Rolling back participant %s to version %d (templates %s)\n", participantName, revision.Version, revision.TemplateRevision)
+	resources, err := p.applyManifest(revision.Definition, objects)
+	if err != nil {
+		return nil, err
+	}
+
+	// the applied objects carry their new generation, the rollback only succeeds once its rollout has been observed
+	ctx, cancel := context.WithTimeout(p.ctx, p.readinessTimeout(profile))
+	defer cancel()
+	if err := readiness.Wait(ctx, participantName, p.readinessGates(revision.Definition, profile, objects)); err != nil {
+		return nil, fmt.Errorf("participant %s did not become ready after the rollback: %w", participantName, err)
+	}
+	return resources, nil
+}
+
+// applyManifest applies the objects, prunes everything else and records the manifest in the history
+func (p ProvisioningAgentImpl) applyManifest(definition model.ParticipantDefinition, objects manifest) ([]model.AppliedObject, error) {
+	// objects are updated with the server state when they are applied, so the manifest is encoded beforehand
+	encoded, err := objects.encode()
+	if err != nil {
+		return nil, err
+	}
+	sortForApply(objects)
+	resources, err := p.runAction(objects, p.applyResource)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.prune(definition.ParticipantName, objects); err != nil {
+		return nil, fmt.Errorf("prune: %w", err)
+	}
+	if err := p.recordHistory(definition, encoded, templateRevision(objects)); err != nil {
+		// the participant was applied successfully, a missing history entry only affects later rollbacks
+		log.Printf("Error recording the manifest history of participant %s: %v\n", definition.ParticipantName, err)
+	}
+	return resources, nil
+}
+
+// recordHistory stores the manifest as the next version unless it equals the latest one, and removes the versions
+// exceeding the history limit
+func (p ProvisioningAgentImpl) recordHistory(definition model.ParticipantDefinition, encoded []byte, revision string) error {
+	if p.config.HistoryLimit <= 0 {
+		return nil
+	}
+	secrets, err := p.historySecrets(definition.ParticipantName)
+	if err != nil {
+		return err
+	}
+	version := 1
+	if len(secrets) > 0 {
+		latest := secrets[len(secrets)-1]
+		if string(latest.Data[historyManifestKey]) == string(encoded) {
+			return nil
+		}
+		version = historyVersion(latest) + 1
+	}
+
+	definitionJson, err := json.Marshal(definition)
+	if err != nil {
+		return err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      historySecretPrefix + strconv.Itoa(version),
+			Namespace: definition.ParticipantName,
+			Labels: map[string]string{
+				LabelManagedBy:        ManagedBy,
+				LabelHistoryOf:        definition.ParticipantName,
+				LabelHistoryVersion:   strconv.Itoa(version),
+				LabelTemplateRevision: revision,
+			},
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: map[string][]byte{
+			historyManifestKey:   encoded,
+			historyDefinitionKey: definitionJson,
+			historyAppliedAtKey:  []byte(time.Now().UTC().Format(time.RFC3339)),
+		},
+	}
+	if err := p.kubeClient.Create(p.ctx, secret); err != nil {
+		return err
+	}
+
+	secrets = append(secrets, *secret)
+	for len(secrets) > p.config.HistoryLimit {
+		if err := client.IgnoreNotFound(p.kubeClient.Delete(p.ctx, &secrets[0])); err != nil {
+			return err
+		}
+		secrets = secrets[1:]
+	}
+	return nil
+}
+
+// historySecrets lists the history of the participant, sorted by version
+func (p ProvisioningAgentImpl) historySecrets(participantName string) ([]corev1.Secret, error) {
+	list := &corev1.SecretList{}
+	err := p.kubeClient.List(p.ctx, list, client.InNamespace(participantName), client.MatchingLabels{
+		LabelManagedBy: ManagedBy,
+		LabelHistoryOf: participantName,
+	})
+	if err != nil {
+		return nil, err
+	}
+	secrets := list.Items
+	sort.Slice(secrets, func(i, j int) bool {
+		return historyVersion(secrets[i]) < historyVersion(secrets[j])
+	})
+	return secrets, nil
+}
+
+func selectVersion(secrets []corev1.Secret, version int) (corev1.Secret, error) {
+	if version == 0 {
+		if len(secrets) < 2 {
+			return corev1.Secret{}, fmt.Errorf("no previous version in the history")
+		}
+		return secrets[len(secrets)-2], nil
+	}
+	for _, secret := range secrets {
+		if historyVersion(secret) == version {
+			return secret, nil
+		}
+	}
+	return corev1.Secret{}, fmt.Errorf("version %d is not in the history", version)
+}
+
+func historyVersion(secret corev1.Secret) int {
+	version, err := strconv.Atoi(secret.Labels[LabelHistoryVersion])
+	if err != nil {
+		return 0
+	}
+	return version
+}
+
+func manifestRevision(secret corev1.Secret) (model.ManifestRevision, error) {
+	revision := model.ManifestRevision{
+		Version:          historyVersion(secret),
+		TemplateRevision: secret.Labels[LabelTemplateRevision],
+	}
+	if err := json.Unmarshal(secret.Data[historyDefinitionKey], &revision.Definition); err != nil {
+		return model.ManifestRevision{}, fmt.Errorf("history secret %s: invalid definition: %w", secret.Name, err)
+	}
+	if appliedAt, err := time.Parse(time.RFC3339, string(secret.Data[historyAppliedAtKey])); err == nil {
+		revision.AppliedAt = appliedAt
+	}
+	return revision, nil
+}
+
+// templateRevision returns the template revision the objects were rendered from
+func templateRevision(objects manifest) string {
+	for _, obj := range objects {
+		if revision := obj.GetLabels()[LabelTemplateRevision]; revision != "" {
+			return revision
+		}
+	}
+	return ""
+}
+
+func (m manifest) encode() ([]byte, error) {
+	docs := make([]string, 0, len(m))
+	for _, obj := range m {
+		doc, err := yaml.Marshal(obj.Object)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(doc))
+	}
+	return []byte(strings.Join(docs, "---\n")), nil
+}
+
+func decodeManifest(content []byte) (manifest, error) {
+	var objects manifest
+	for _, doc := range strings.Split(string(content), "\n---\n") {
+		if strings.TrimSpace(doc) == "" {
+			continue
+		}
+		obj := &unstructured.Unstructured{}
+		if err := yaml.Unmarshal([]byte(doc), &obj.Object); err != nil {
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	return objects, nil
+}
@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"k8s-provisioner/internal/model"
+	"log"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// AnnotationDefinition holds the definition a participant namespace was last applied with, so that its templates can
+// be rendered again without the original request
+const AnnotationDefinition = "provisioner.fulcrum.io/definition"
+
+// ProvisionedParticipant is a participant whose namespace was applied by the provisioner
+type ProvisionedParticipant struct {
+	Definition model.ParticipantDefinition
+	// Revision of the templates the participant was last applied with
+	Revision string
+}
+
+// setDefinition records the definition on the namespace object of a participant
+func setDefinition(object *unstructured.Unstructured, definition model.ParticipantDefinition) error {
+	content, err := json.Marshal(definition)
+	if err != nil {
+		return err
+	}
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[AnnotationDefinition] = string(content)
+	object.SetAnnotations(annotations)
+	return nil
+}
+
+// LookupParticipant returns the provisioned participant with the given name, false if its namespace does not exist or
+// has no recorded definition
+func LookupParticipant(c client.Client, ctx context.Context, name string) (ProvisionedParticipant, bool, error) {
+	namespace := &corev1.Namespace{}
+	if err := c.Get(ctx, client.ObjectKey{Name: name}, namespace); err != nil {
+		return ProvisionedParticipant{}, false, client.IgnoreNotFound(err)
+	}
+	content, ok := namespace.Annotations[AnnotationDefinition]
+	if !ok || namespace.Labels[LabelManagedBy] != ManagedBy {
+		return ProvisionedParticipant{}, false, nil
+	}
+	var definition model.ParticipantDefinition
+	if err := json.Unmarshal([]byte(content), &definition); err != nil {
+		return ProvisionedParticipant{}, false, fmt.Errorf("namespace %s: invalid definition: %w", name, err)
+	}
+	return ProvisionedParticipant{Definition: definition, Revision: namespace.Labels[LabelTemplateRevision]}, true, nil
+}
+
+// ProvisionedParticipants discovers all participants by the labels on their namespaces, sorted by name. Namespaces
+// that were applied before the definition was recorded are skipped.
+func ProvisionedParticipants(c client.Client, ctx context.Context) ([]ProvisionedParticipant, error) {
+	namespaces := &corev1.NamespaceList{}
+	if err := c.List(ctx, namespaces, client.MatchingLabels{LabelManagedBy: ManagedBy}); err != nil {
+		return nil, err
+	}
+
+	var participants []ProvisionedParticipant
+	for _, namespace := range namespaces.Items {
+		if !namespace.DeletionTimestamp.IsZero() {
+			continue
+		}
+		content, ok := namespace.Annotations[AnnotationDefinition]
+		if !ok {
+			log.Printf("Namespace %s has no %s annotation, skipping it\n", namespace.Name, AnnotationDefinition)
+			continue
+		}
+		var definition model.ParticipantDefinition
+		if err := json.Unmarshal([]byte(content), &definition); err != nil {
+			return nil, fmt.Errorf("namespace %s: invalid definition: %w", namespace.Name, err)
+		}
+		participants = append(participants, ProvisionedParticipant{
+			Definition: definition,
+			Revision:   namespace.Labels[LabelTemplateRevision],
+		})
+	}
+	sort.Slice(participants, func(i, j int) bool {
+		return participants[i].Definition.ParticipantName < participants[j].Definition.ParticipantName
+	})
+	return participants, nil
+}
@@ -0,0 +1,45 @@
+package provisioner
+
+import (
+	"sort"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// applyOrder ranks kinds by their dependencies: objects are applied in ascending and deleted in descending rank.
+// Kinds that are not listed are applied last.
+var applyOrder = map[string]int{
+	"Namespace":             0,
+	"ServiceAccount":        1,
+	"Role":                  1,
+	"RoleBinding":           1,
+	"ConfigMap":             2,
+	"Secret":                2,
+	"PersistentVolumeClaim": 2,
+	"Service":               3,
+	"Deployment":            4,
+	"StatefulSet":           4,
+	"Ingress":               5,
+}
+
+func kindRank(kind string) int {
+	if rank, ok := applyOrder[kind]; ok {
+		return rank
+	}
+	return len(applyOrder)
+}
+
+// sortForApply orders objects by the rank of their kind, objects of the same rank keep their template order
+func sortForApply(objects []*unstructured.Unstructured) {
+	sort.SliceStable(objects, func(i, j int) bool {
+		return kindRank(objects[i].GetKind()) < kindRank(objects[j].GetKind())
+	})
+}
+
+// sortForDelete orders objects so that dependents are deleted before the objects they depend on
+func sortForDelete(objects []*unstructured.Unstructured) {
+	sortForApply(objects)
+	for i, j := 0, len(objects)-1; i < j; i, j = i+1, j-1 {
+		objects[i], objects[j] = objects[j], objects[i]
+	}
+}
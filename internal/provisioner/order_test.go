@@ -0,0 +1,81 @@
+package provisioner
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func object(kind string, name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetKind(kind)
+	obj.SetName(name)
+	return obj
+}
+
+func keys(objects []*unstructured.Unstructured) []string {
+	var result []string
+	for _, obj := range objects {
+		result = append(result, obj.GetKind()+"/"+obj.GetName())
+	}
+	return result
+}
+
+func TestSortOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		objects    []*unstructured.Unstructured
+		wantApply  []string
+		wantDelete []string
+	}{
+		{
+			name: "dependencies first",
+			objects: []*unstructured.Unstructured{
+				object("Ingress", "controlplane"),
+				object("Deployment", "controlplane"),
+				object("Service", "controlplane"),
+				object("ConfigMap", "config"),
+				object("Namespace", "alice"),
+			},
+			wantApply:  []string{"Namespace/alice", "ConfigMap/config", "Service/controlplane", "Deployment/controlplane", "Ingress/controlplane"},
+			wantDelete: []string{"Ingress/controlplane", "Deployment/controlplane", "Service/controlplane", "ConfigMap/config", "Namespace/alice"},
+		},
+		{
+			name: "same rank keeps template order",
+			objects: []*unstructured.Unstructured{
+				object("Deployment", "controlplane"),
+				object("StatefulSet", "postgres"),
+				object("Deployment", "dataplane"),
+			},
+			wantApply:  []string{"Deployment/controlplane", "StatefulSet/postgres", "Deployment/dataplane"},
+			wantDelete: []string{"Deployment/dataplane", "StatefulSet/postgres", "Deployment/controlplane"},
+		},
+		{
+			name: "unknown kinds last",
+			objects: []*unstructured.Unstructured{
+				object("CronJob", "cleanup"),
+				object("Secret", "credentials"),
+			},
+			wantApply:  []string{"Secret/credentials", "CronJob/cleanup"},
+			wantDelete: []string{"CronJob/cleanup", "Secret/credentials"},
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			apply := slices.Clone(test.objects)
+			sortForApply(apply)
+			if got := keys(apply); !slices.Equal(got, test.wantApply) {
+				t.Errorf("sortForApply() = %v, want %v", got, test.wantApply)
+			}
+			remove := slices.Clone(test.objects)
+			sortForDelete(remove)
+			if got := keys(remove); !slices.Equal(got, test.wantDelete) {
+				t.Errorf("sortForDelete() = %v, want %v", got, test.wantDelete)
+			}
+		})
+	}
+}
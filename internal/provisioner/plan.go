@@ -0,0 +1,246 @@
+package provisioner
+
+import (
+	"context"
+	"k8s-provisioner/internal/model"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// number of unchanged lines shown around every change of a diff
+const diffContext = 3
+
+// operations reported in a model.ObjectChange
+const (
+	OperationCreate    = "create"
+	OperationUpdate    = "update"
+	OperationUnchanged = "unchanged"
+	OperationDelete    = "delete"
+	OperationAbsent    = "absent"
+)
+
+// PlanCreateResources renders the templates of the participant and runs a server-side dry-run apply for every object,
+// reporting how each object would differ from the one that currently exists in the cluster, and which objects would
+// be pruned
+func (p ProvisioningAgentImpl) PlanCreateResources(definition model.ParticipantDefinition) ([]model.ObjectChange, error) {
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	profile, err := LookupProfile(definition.Profile)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := p.renderObjects(definition, profile)
+	if err != nil {
+		return nil, err
+	}
+	sortForApply(objects)
+	var changes []model.ObjectChange
+	_, err = p.runAction(objects, func(c client.Client, ctx context.Context, object client.Object) error {
+		change, err := planApply(c, ctx, object.(*unstructured.Unstructured))
+		if err != nil {
+			return err
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stale, err := staleObjects(p.kubeClient, p.ctx, definition.ParticipantName, objects)
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range stale {
+		change := newObjectChange(obj, OperationDelete)
+		change.Diff = diffObjects(obj, nil)
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// PlanDeleteResources reports which objects of the participant would be deleted
+func (p ProvisioningAgentImpl) PlanDeleteResources(definition model.ParticipantDefinition) ([]model.ObjectChange, error) {
+	profile, err := LookupProfile(definition.Profile)
+	if err != nil {
+		return nil, err
+	}
+	objects, err := p.renderObjects(definition, profile)
+	if err != nil {
+		return nil, err
+	}
+	stale, err := staleObjects(p.kubeClient, p.ctx, definition.ParticipantName, objects)
+	if err != nil {
+		return nil, err
+	}
+	sortForDelete(objects)
+	var changes []model.ObjectChange
+	_, err = p.runAction(append(stale, objects...), func(c client.Client, ctx context.Context, object client.Object) error {
+		rendered := object.(*unstructured.Unstructured)
+		existing, err := getExisting(c, ctx, rendered)
+		if err != nil {
+			return err
+		}
+		change := newObjectChange(rendered, OperationAbsent)
+		if existing != nil {
+			change.Operation = OperationDelete
+			change.Diff = diffObjects(existing, nil)
+		}
+		changes = append(changes, change)
+		return nil
+	})
+	return changes, err
+}
+
+func planApply(c client.Client, ctx context.Context, rendered *unstructured.Unstructured) (model.ObjectChange, error) {
+	existing, err := getExisting(c, ctx, rendered)
+	if err != nil {
+		return model.ObjectChange{}, err
+	}
+
+	planned := rendered.DeepCopy()
+	err = c.Patch(ctx, planned, client.Apply, client.FieldOwner(fieldOwner), client.ForceOwnership, client.DryRunAll)
+	if existing == nil && apierrors.IsNotFound(err) {
+		// the namespace does not exist yet, so the server cannot dry-run objects in it
+		planned = rendered
+	} else if err != nil {
+		return model.ObjectChange{}, err
+	}
+
+	if existing == nil {
+		change := newObjectChange(rendered, OperationCreate)
+		change.Diff = diffObjects(nil, planned)
+		return change, nil
+	}
+	diff := diffObjects(existing, planned)
+	if diff == "" {
+		return newObjectChange(rendered, OperationUnchanged), nil
+	}
+	change := newObjectChange(rendered, OperationUpdate)
+	change.Diff = diff
+	return change, nil
+}
+
+// getExisting fetches the cluster state of the given object, or nil if it does not exist
+func getExisting(c client.Client, ctx context.Context, object *unstructured.Unstructured) (*unstructured.Unstructured, error) {
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(object.GroupVersionKind())
+	err := c.Get(ctx, client.ObjectKeyFromObject(object), existing)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return existing, nil
+}
+
+// normalize strips the fields that are maintained by the server and would show up in every diff
+func normalize(object *unstructured.Unstructured) map[string]interface{} {
+	content := object.DeepCopy().Object
+	delete(content, "status")
+	for _, field := range []string{"managedFields", "resourceVersion", "uid", "generation", "creationTimestamp"} {
+		unstructured.RemoveNestedField(content, "metadata", field)
+	}
+	unstructured.RemoveNestedField(content, "metadata", "annotations", "deployment.kubernetes.io/revision")
+	if annotations, found, _ := unstructured.NestedMap(content, "metadata", "annotations"); found && len(annotations) == 0 {
+		unstructured.RemoveNestedField(content, "metadata", "annotations")
+	}
+	return content
+}
+
+func newObjectChange(object *unstructured.Unstructured, operation string) model.ObjectChange {
+	return model.ObjectChange{
+		Kind:      object.GetKind(),
+		Namespace: object.GetNamespace(),
+		Name:      object.GetName(),
+		Operation: operation,
+	}
+}
+
+// diffObjects returns a line diff of the YAML representation of both objects, either of which may be nil
+func diffObjects(from *unstructured.Unstructured, to *unstructured.Unstructured) string {
+	return diffLines(toYamlLines(from), toYamlLines(to))
+}
+
+func toYamlLines(object *unstructured.Unstructured) []string {
+	if object == nil {
+		return nil
+	}
+	out, err := yaml.Marshal(normalize(object))
+	if err != nil {
+		return []string{err.Error()}
+	}
+	return strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+}
+
+// diffLines computes the longest common subsequence of both inputs and renders removed lines with a "-" and added
+// lines with a "+" prefix. Unchanged lines further than diffContext away from a change are elided.
+func diffLines(from []string, to []string) string {
+	lcs := make([][]int, len(from)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []string
+	var changed []bool
+	hasChanges := false
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			lines, changed = append(lines, "  "+from[i]), append(changed, false)
+			i++
+			j++
+		case i < len(from) && (j == len(to) || lcs[i+1][j] >= lcs[i][j+1]):
+			lines, changed = append(lines, "- "+from[i]), append(changed, true)
+			hasChanges = true
+			i++
+		default:
+			lines, changed = append(lines, "+ "+to[j]), append(changed, true)
+			hasChanges = true
+			j++
+		}
+	}
+	if !hasChanges {
+		return ""
+	}
+
+	var out strings.Builder
+	elided := false
+	for index, line := range lines {
+		if !nearChange(changed, index) {
+			if !elided && out.Len() > 0 {
+				out.WriteString("  ...\n")
+			}
+			elided = true
+			continue
+		}
+		elided = false
+		out.WriteString(line)
+		out.WriteString("\n")
+	}
+	return out.String()
+}
+
+func nearChange(changed []bool, index int) bool {
+	for i := max(0, index-diffContext); i <= min(len(changed)-1, index+diffContext); i++ {
+		if changed[i] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+)
+
+func numberedLines(count int) []string {
+	lines := make([]string, count)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("line%d", i+1)
+	}
+	return lines
+}
+
+func replaced(lines []string, index int, line string) []string {
+	result := append([]string(nil), lines...)
+	result[index] = line
+	return result
+}
+
+func TestDiffLines(t *testing.T) {
+	ten := numberedLines(10)
+	tests := []struct {
+		name string
+		from []string
+		to   []string
+		want string
+	}{
+		{
+			name: "unchanged",
+			from: []string{"a", "b"},
+			to:   []string{"a", "b"},
+			want: "",
+		},
+		{
+			name: "both empty",
+			want: "",
+		},
+		{
+			name: "created",
+			to:   []string{"a", "b"},
+			want: "+ a\n+ b\n",
+		},
+		{
+			name: "deleted",
+			from: []string{"a", "b"},
+			want: "- a\n- b\n",
+		},
+		{
+			name: "changed line",
+			from: []string{"a", "b", "c"},
+			to:   []string{"a", "x", "c"},
+			want: "  a\n- b\n+ x\n  c\n",
+		},
+		{
+			name: "inserted line",
+			from: []string{"a", "c"},
+			to:   []string{"a", "b", "c"},
+			want: "  a\n+ b\n  c\n",
+		},
+		{
+			name: "leading context is elided without a marker",
+			from: ten,
+			to:   replaced(ten, 9, "changed"),
+			want: "  line7\n  line8\n  line9\n- line10\n+ changed\n",
+		},
+		{
+			name: "trailing context is elided with a marker",
+			from: ten,
+			to:   replaced(ten, 0, "changed"),
+			want: "- line1\n+ changed\n  line2\n  line3\n  line4\n  ...\n",
+		},
+		{
+			name: "distant changes are separated by a marker",
+			from: ten,
+			to:   replaced(replaced(ten, 0, "first"), 9, "last"),
+			want: "- line1\n+ first\n  line2\n  line3\n  line4\n  ...\n  line7\n  line8\n  line9\n- line10\n+ last\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := diffLines(test.from, test.to); got != test.want {
+				t.Errorf("diffLines() =\n%s\nwant\n%s", got, test.want)
+			}
+		})
+	}
+}
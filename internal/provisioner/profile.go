@@ -0,0 +1,123 @@
+package provisioner
+
+import (
+	"fmt"
+	"k8s-provisioner/internal/model"
+	"sort"
+	"time"
+)
+
+// DefaultProfile is used for participants that do not select a profile
+const DefaultProfile = "edc-aio"
+
+// Profile is a named bundle of templates that are deployed together for a participant
+type Profile struct {
+	Name        string
+	Description string
+	// Templates are rendered in this order, their objects are applied in the order of their kinds (see applyOrder)
+	Templates []string
+	// Deployments must become ready before the participant is considered ready
+	Deployments []string
+	// Overrides are applied on top of the cluster-wide defaults, participants can still override them
+	Overrides map[string]model.ComponentOverrides
+	// HealthChecks are paths below the ingress prefix of the participant that must respond successfully before the
+	// participant is considered ready
+	HealthChecks []string
+	// ReadinessTimeout overrides how long the deployments may take to become ready, zero uses the configured default
+	ReadinessTimeout time.Duration
+}
+
+var scaledDataPlaneReplicas = int32(3)
+
+// readiness endpoints of the components, as exposed by their ingresses
+const (
+	controlPlaneHealthCheck = "/health/api/check/readiness"
+	identityHubHealthCheck  = "/ih-health/api/check/readiness"
+)
+
+var profiles = map[string]Profile{
+	"edc-aio": {
+		Name:         "edc-aio",
+		Description:  "EDC All-in-one deployment",
+		Templates:    []string{"base.yaml", "controlplane.yaml", "dataplane.yaml", "identityhub.yaml"},
+		Deployments:  []string{ComponentControlPlane, ComponentIdentityHub, ComponentDataPlane},
+		HealthChecks: []string{controlPlaneHealthCheck, identityHubHealthCheck},
+	},
+	"connector-only": {
+		Name:         "connector-only",
+		Description:  "EDC connector (control plane and data plane) without IdentityHub",
+		Templates:    []string{"base.yaml", "controlplane.yaml", "dataplane.yaml"},
+		Deployments:  []string{ComponentControlPlane, ComponentDataPlane},
+		HealthChecks: []string{controlPlaneHealthCheck},
+	},
+	"identityhub-only": {
+		Name:         "identityhub-only",
+		Description:  "IdentityHub without EDC connector",
+		Templates:    []string{"base.yaml", "identityhub.yaml"},
+		Deployments:  []string{ComponentIdentityHub},
+		HealthChecks: []string{identityHubHealthCheck},
+	},
+	"dataplane-scaled": {
+		Name:         "dataplane-scaled",
+		Description:  "EDC All-in-one deployment with multiple data plane replicas",
+		Templates:    []string{"base.yaml", "controlplane.yaml", "dataplane.yaml", "identityhub.yaml"},
+		Deployments:  []string{ComponentControlPlane, ComponentIdentityHub, ComponentDataPlane},
+		HealthChecks: []string{controlPlaneHealthCheck, identityHubHealthCheck},
+		Overrides: map[string]model.ComponentOverrides{
+			ComponentDataPlane: {Replicas: &scaledDataPlaneReplicas},
+		},
+		ReadinessTimeout: 15 * time.Minute,
+	},
+}
+
+// LookupProfile returns the profile with the given name, an empty name selects the DefaultProfile
+func LookupProfile(name string) (Profile, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q, available profiles are %v", name, ProfileNames())
+	}
+	return profile, nil
+}
+
+// Profiles returns all known profiles, sorted by name
+func Profiles() []Profile {
+	result := make([]Profile, 0, len(profiles))
+	for _, name := range ProfileNames() {
+		result = append(result, profiles[name])
+	}
+	return result
+}
+
+// ProfileNames returns the names of all known profiles, sorted alphabetically
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// usedTemplates returns the names of the templates that at least one profile renders
+func usedTemplates() map[string]bool {
+	used := make(map[string]bool)
+	for _, profile := range profiles {
+		for _, name := range profile.Templates {
+			used[name] = true
+		}
+	}
+	return used
+}
+
+// Includes is true if the profile deploys the given component
+func (p Profile) Includes(component string) bool {
+	for _, deployment := range p.Deployments {
+		if deployment == component {
+			return true
+		}
+	}
+	return false
+}
@@ -2,106 +2,241 @@ package provisioner
 
 import (
 	"context"
-	_ "embed"
+	"fmt"
 	"k8s-provisioner/internal/kube"
 	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/readiness"
+	"log"
 	"strings"
+	"time"
 
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/yaml"
 )
 
+// ReadinessCallback is invoked once the resources of a participant are ready, or with the reason why they did not
+// become ready, usually a *kube.ReadinessError
+type ReadinessCallback func(definition model.ParticipantDefinition, err error)
+
 // ProvisioningAgent manages resources on a Kubernetes cluster
 type ProvisioningAgent interface {
-	CreateResources(model.ParticipantDefinition, func(definition model.ParticipantDefinition)) (map[string]string, error)
-	DeleteResources(model.ParticipantDefinition) (map[string]string, error)
+	CreateResources(model.ParticipantDefinition, ReadinessCallback) ([]model.AppliedObject, error)
+	// ApplyResources applies the resources of a participant like CreateResources, but does not wait for their readiness
+	ApplyResources(model.ParticipantDefinition) ([]model.AppliedObject, error)
+	DeleteResources(model.ParticipantDefinition) ([]model.AppliedObject, error)
+	// PlanCreateResources and PlanDeleteResources report what the respective operation would change, without changing anything
+	PlanCreateResources(model.ParticipantDefinition) ([]model.ObjectChange, error)
+	PlanDeleteResources(model.ParticipantDefinition) ([]model.ObjectChange, error)
+	// History lists the manifests that were applied for a participant, the latest first
+	History(participantName string) ([]model.ManifestRevision, error)
+	// RollbackResources applies an earlier version from the history again and waits until the participant is ready
+	RollbackResources(participantName string, version int) ([]model.AppliedObject, error)
+	// ReadinessGates returns the checks that must pass before the participant is ready and its data can be seeded
+	ReadinessGates(model.ParticipantDefinition) ([]readiness.Gate, error)
+	// Describe reports the namespace of a participant and the public URLs of its APIs, without changing anything
+	Describe(model.ParticipantDefinition) (model.ProvisionedResources, error)
 }
 
-// Centralize deployment names used for readiness checks
-var participantDeploymentNames = []string{"controlplane", "identityhub", "dataplane"}
+// fieldOwner identifies the provisioner as the manager of the fields it applies
+const fieldOwner = "go-provisioner"
+
+// Config contains the settings of a ProvisioningAgentImpl
+type Config struct {
+	// Defaults are the values templates are rendered with, they can be customized per participant
+	Defaults TemplateValues
+	// Templates provides the templates the profiles refer to
+	Templates TemplateSource
+	// NamespaceDeletionTimeout is how long DeleteResources waits for the namespace of the participant to be removed
+	// completely. Zero means it returns as soon as the deletion was requested.
+	NamespaceDeletionTimeout time.Duration
+	// ReadinessTimeout is how long the deployments of a participant may take to become ready, unless its profile
+	// specifies a different timeout
+	ReadinessTimeout time.Duration
+	// HistoryLimit is the number of applied manifests that are kept per participant, zero disables the history
+	HistoryLimit int
+	// ReadinessTracker wakes up the deployment waits of the readiness gates, without one they poll
+	ReadinessTracker *kube.ReadinessTracker
+	// IngressAddressGates makes participants wait for an address on each of their ingresses. Not every ingress
+	// controller publishes one, so it is disabled by default.
+	IngressAddressGates bool
+}
 
 type ProvisioningAgentImpl struct {
 	ctx        context.Context
 	kubeClient client.Client
+	config     Config
 }
 
-//go:embed templates/connector.yaml
-var participantYaml string
-
-//go:embed templates/identityhub.yaml
-var identityhubYaml string
-
-func NewProvisioningAgent(context context.Context, kubeClient client.Client) ProvisioningAgent {
+// NewProvisioningAgent creates an agent that renders and applies the templates of each participant's profile
+func NewProvisioningAgent(context context.Context, kubeClient client.Client, config Config) ProvisioningAgent {
 	return &ProvisioningAgentImpl{
 		ctx:        context,
 		kubeClient: kubeClient,
+		config:     config,
 	}
 }
 
-func (p ProvisioningAgentImpl) CreateResources(definition model.ParticipantDefinition, readyCallback func(model.ParticipantDefinition)) (map[string]string, error) {
-	resources1, e1 := p.applyYaml(&definition.ParticipantName, &definition.Did, participantYaml, p.applyResource)
-	if e1 != nil {
-		return nil, e1
+func (p ProvisioningAgentImpl) CreateResources(definition model.ParticipantDefinition, readyCallback ReadinessCallback) ([]model.AppliedObject, error) {
+	if err := definition.Validate(); err != nil {
+		return nil, err
 	}
-	resources2, e2 := p.applyYaml(&definition.ParticipantName, &definition.Did, identityhubYaml, p.applyResource)
-	if e2 != nil {
-		return nil, e2
+	profile, err := LookupProfile(definition.Profile)
+	if err != nil {
+		return nil, err
 	}
-	// Merge maps
-	mergedResources := make(map[string]string)
-	for k, v := range resources1 {
-		mergedResources[k] = v
+	objects, err := p.renderObjects(definition, profile)
+	if err != nil {
+		return nil, err
 	}
-	for k, v := range resources2 {
-		mergedResources[k] = v
+	mergedResources, err := p.applyManifest(definition, objects)
+	if err != nil {
+		return nil, err
 	}
+	// built from the applied objects, so that an update or start does not pass on the rollout of the previous generation
+	gates := p.readinessGates(definition, profile, objects)
 
 	// Introduce a clear variable for namespace usage
 	namespace := definition.ParticipantName
 
 	// Start readiness wait in a separate goroutine (non-blocking definition)
-	kube.WaitForDeploymentsAsync(
-		p.kubeClient,
-		p.ctx,
-		namespace,
-		participantDeploymentNames,
-		func() {
-			readyCallback(definition)
-		},
-	)
+	log.Println("Waiting for", len(gates), "readiness gates in namespace", namespace)
+	ctx, cancel := context.WithTimeout(p.ctx, p.readinessTimeout(profile))
+	go func() {
+		defer cancel()
+		err := readiness.Wait(ctx, namespace, gates)
+		if err != nil {
+			log.Printf("Readiness check failed for namespace %s: %v\n", namespace, err)
+		}
+		readyCallback(definition, err)
+	}()
 	return mergedResources, nil
 }
 
-func (p ProvisioningAgentImpl) DeleteResources(definition model.ParticipantDefinition) (map[string]string, error) {
-	resources1, e1 := p.applyYaml(&definition.ParticipantName, &definition.Did, participantYaml, p.deleteResource)
-	if e1 != nil {
-		return nil, e1
+func (p ProvisioningAgentImpl) ApplyResources(definition model.ParticipantDefinition) ([]model.AppliedObject, error) {
+	if err := definition.Validate(); err != nil {
+		return nil, err
+	}
+	profile, err := LookupProfile(definition.Profile)
+	if err != nil {
+		return nil, err
 	}
-	resources2, e2 := p.applyYaml(&definition.ParticipantName, &definition.Did, identityhubYaml, p.deleteResource)
-	if e2 != nil {
-		return nil, e2
+	objects, err := p.renderObjects(definition, profile)
+	if err != nil {
+		return nil, err
 	}
-	// Merge maps
-	mergedResources := make(map[string]string)
-	for k, v := range resources1 {
-		mergedResources[k] = v
+	return p.applyManifest(definition, objects)
+}
+
+func (p ProvisioningAgentImpl) DeleteResources(definition model.ParticipantDefinition) ([]model.AppliedObject, error) {
+	profile, err := LookupProfile(definition.Profile)
+	if err != nil {
+		return nil, err
 	}
-	for k, v := range resources2 {
-		mergedResources[k] = v
+	objects, err := p.renderObjects(definition, profile)
+	if err != nil {
+		return nil, err
 	}
-	return mergedResources, nil
+	// objects that are no longer rendered would otherwise only be removed together with the namespace
+	if err := p.prune(definition.ParticipantName, objects); err != nil {
+		return nil, fmt.Errorf("prune: %w", err)
+	}
+	sortForDelete(objects)
+	resources, err := p.runAction(objects, p.deleteResource)
+	if err != nil {
+		return nil, err
+	}
+	if p.config.NamespaceDeletionTimeout > 0 {
+		ctx, cancel := context.WithTimeout(p.ctx, p.config.NamespaceDeletionTimeout)
+		defer cancel()
+		if err := kube.WaitForNamespaceDeleted(p.kubeClient, ctx, definition.ParticipantName); err != nil {
+			return nil, fmt.Errorf("namespace %s was not removed: %w", definition.ParticipantName, err)
+		}
+	}
+	return resources, nil
+}
+
+// readinessTimeout is how long the deployments of a profile may take to become ready
+func (p ProvisioningAgentImpl) readinessTimeout(profile Profile) time.Duration {
+	if profile.ReadinessTimeout > 0 {
+		return profile.ReadinessTimeout
+	}
+	return p.config.ReadinessTimeout
+}
+
+// renderObjects renders all templates of the profile and returns the objects they contain, in template order. Every
+// object is labelled with the participant and the revision of the templates.
+func (p ProvisioningAgentImpl) renderObjects(definition model.ParticipantDefinition, profile Profile) ([]*unstructured.Unstructured, error) {
+	values, err := p.templateValues(definition, profile)
+	if err != nil {
+		return nil, err
+	}
+	templates, err := p.config.Templates.Templates()
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []*unstructured.Unstructured
+	used := TemplateSet{}
+	for _, name := range profile.Templates {
+		text, err := templates.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		used[name] = text
+		templateObjects, err := parseYaml(name, text, values)
+		if err != nil {
+			return nil, err
+		}
+		objects = append(objects, templateObjects...)
+	}
+
+	revision := used.Revision()
+	for _, obj := range objects {
+		setLabels(obj, definition.ParticipantName, revision)
+		if obj.GetKind() == "Namespace" {
+			if err := setDefinition(obj, definition); err != nil {
+				return nil, err
+			}
+		}
+		if definition.Stopped && workloadKinds[obj.GetKind()] {
+			if err := unstructured.SetNestedField(obj.Object, int64(0), "spec", "replicas"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return objects, nil
+}
+
+// templateValues returns the values the templates of the profile are rendered with for the participant
+func (p ProvisioningAgentImpl) templateValues(definition model.ParticipantDefinition, profile Profile) (TemplateValues, error) {
+	defaults, err := p.config.Defaults.WithOverrides(profile.Overrides)
+	if err != nil {
+		return TemplateValues{}, fmt.Errorf("profile %s: %w", profile.Name, err)
+	}
+	return NewTemplateValues(definition, defaults)
+}
+
+func (p ProvisioningAgentImpl) runAction(objects []*unstructured.Unstructured, kubernetesAction action) ([]model.AppliedObject, error) {
+	resources := make([]model.AppliedObject, 0, len(objects))
+	for _, obj := range objects {
+		if err := kubernetesAction(p.kubeClient, p.ctx, obj); err != nil {
+			return nil, fmt.Errorf("%s %s: %w", obj.GetKind(), obj.GetName(), err)
+		}
+		resources = append(resources, model.AppliedObject{Kind: obj.GetKind(), Name: obj.GetName(), Generation: obj.GetGeneration()})
+	}
+	return resources, nil
 }
 
-func (p ProvisioningAgentImpl) applyYaml(participantName *string, did *string, yamlString string, kubernetesAction action) (map[string]string, error) {
-	yamlString = strings.Replace(yamlString, "${PARTICIPANT_NAME}", *participantName, -1)
-	yamlString = strings.Replace(yamlString, "$PARTICIPANT_NAME", *participantName, -1)
-	yamlString = strings.Replace(yamlString, "${PARTICIPANT_ID}", *did, -1)
-	yamlString = strings.Replace(yamlString, "$PARTICIPANT_ID", *did, -1)
+func parseYaml(templateName string, templateText string, values TemplateValues) ([]*unstructured.Unstructured, error) {
+	yamlString, err := renderTemplate(templateName, templateText, values)
+	if err != nil {
+		return nil, err
+	}
 
 	docs := strings.Split(yamlString, "---")
 
-	resourceMap := make(map[string]string)
+	var objects []*unstructured.Unstructured
 	for _, doc := range docs {
 		doc = strings.TrimSpace(doc)
 		if doc == "" {
@@ -110,16 +245,11 @@ func (p ProvisioningAgentImpl) applyYaml(participantName *string, did *string, y
 
 		obj := &unstructured.Unstructured{}
 		if err := yaml.Unmarshal([]byte(doc), &obj); err != nil {
-			return nil, err
-		}
-
-		resourceMap[obj.GetName()] = obj.GetKind()
-		err := kubernetesAction(p.kubeClient, p.ctx, obj)
-		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("template %s: %w", templateName, err)
 		}
+		objects = append(objects, obj)
 	}
-	return resourceMap, nil
+	return objects, nil
 }
 
 func (p ProvisioningAgentImpl) applyResource(c client.Client, ctx context.Context, object client.Object) error {
@@ -128,7 +258,7 @@ func (p ProvisioningAgentImpl) applyResource(c client.Client, ctx context.Contex
 		ctx,
 		object,
 		client.Apply,
-		client.FieldOwner("go-provisioner"),
+		client.FieldOwner(fieldOwner),
 		// Optional: take ownership of fields (overwrites conflicts)
 		client.ForceOwnership,
 	)
@@ -137,6 +267,7 @@ func (p ProvisioningAgentImpl) applyResource(c client.Client, ctx context.Contex
 
 type action func(client.Client, context.Context, client.Object) error
 
+// deleteResource deletes the object, objects that do not exist (anymore) are considered deleted
 func (p ProvisioningAgentImpl) deleteResource(c client.Client, ctx context.Context, object client.Object) error {
-	return c.Delete(ctx, object)
+	return client.IgnoreNotFound(c.Delete(ctx, object))
 }
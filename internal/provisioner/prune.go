@@ -0,0 +1,97 @@
+package provisioner
+
+import (
+	"context"
+	"log"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// labels the provisioner puts on every object it applies
+const (
+	LabelManagedBy        = "app.kubernetes.io/managed-by"
+	LabelParticipant      = "provisioner.fulcrum.io/participant"
+	LabelTemplateRevision = "provisioner.fulcrum.io/template-revision"
+)
+
+// ManagedBy is the value of LabelManagedBy on objects applied by the provisioner
+const ManagedBy = fieldOwner
+
+// prunableKinds are the namespaced kinds that are searched for objects which are no longer part of the templates.
+// todo: derive from the templates, objects of other kinds are only removed together with the namespace
+var prunableKinds = []schema.GroupVersionKind{
+	{Version: "v1", Kind: "ServiceAccount"},
+	{Version: "v1", Kind: "ConfigMap"},
+	{Version: "v1", Kind: "Secret"},
+	{Version: "v1", Kind: "PersistentVolumeClaim"},
+	{Version: "v1", Kind: "Service"},
+	{Group: "apps", Version: "v1", Kind: "Deployment"},
+	{Group: "apps", Version: "v1", Kind: "StatefulSet"},
+	{Group: "networking.k8s.io", Version: "v1", Kind: "Ingress"},
+}
+
+// ManagedSelector selects the objects the provisioner applied for the given participant
+func ManagedSelector(participantName string) client.MatchingLabels {
+	return client.MatchingLabels{
+		LabelManagedBy:   ManagedBy,
+		LabelParticipant: participantName,
+	}
+}
+
+// setLabels marks the object as belonging to the participant and the template revision it was rendered from
+func setLabels(object *unstructured.Unstructured, participantName string, revision string) {
+	labels := object.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[LabelManagedBy] = ManagedBy
+	labels[LabelParticipant] = participantName
+	labels[LabelTemplateRevision] = revision
+	object.SetLabels(labels)
+}
+
+// staleObjects lists the objects in the participant namespace that carry the provisioner's labels but are not among
+// the rendered objects anymore, e.g. because they were removed from a template. They are returned in deletion order.
+func staleObjects(c client.Client, ctx context.Context, participantName string, rendered []*unstructured.Unstructured) ([]*unstructured.Unstructured, error) {
+	current := make(map[string]bool, len(rendered))
+	for _, obj := range rendered {
+		current[objectKey(obj)] = true
+	}
+
+	var stale []*unstructured.Unstructured
+	for _, gvk := range prunableKinds {
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		if err := c.List(ctx, list, client.InNamespace(participantName), ManagedSelector(participantName)); err != nil {
+			return nil, err
+		}
+		for i := range list.Items {
+			obj := &list.Items[i]
+			obj.SetGroupVersionKind(gvk)
+			if !current[objectKey(obj)] {
+				stale = append(stale, obj)
+			}
+		}
+	}
+	sortForDelete(stale)
+	return stale, nil
+}
+
+// prune deletes the stale objects of the participant
+func (p ProvisioningAgentImpl) prune(participantName string, rendered []*unstructured.Unstructured) error {
+	stale, err := staleObjects(p.kubeClient, p.ctx, participantName, rendered)
+	if err != nil {
+		return err
+	}
+	for _, obj := range stale {
+		log.Printf("Pruning %s %s/%s, it is no longer part of the templates\n", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+	}
+	_, err = p.runAction(stale, p.deleteResource)
+	return err
+}
+
+func objectKey(object *unstructured.Unstructured) string {
+	return object.GetKind() + "/" + object.GetNamespace() + "/" + object.GetName()
+}
@@ -0,0 +1,57 @@
+package provisioner
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"sigs.k8s.io/yaml"
+)
+
+// matches placeholders of the legacy ${VARIABLE} syntax, and the marker text/template emits for missing map keys
+var unresolvedPlaceholder = regexp.MustCompile(`\$\{[A-Za-z0-9_]+}|<no value>`)
+
+// helper functions available to the provisioning templates
+var templateFuncs = template.FuncMap{
+	"toYaml": toYaml,
+	"indent": indent,
+}
+
+// renderTemplate renders a provisioning template with the given values. Rendering fails if a value is missing, if
+// the template references a value that does not exist, or if a placeholder was left unresolved in the output.
+func renderTemplate(name string, text string, values TemplateValues) (string, error) {
+	if err := values.Validate(); err != nil {
+		return "", fmt.Errorf("template %s: %w", name, err)
+	}
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("parse template %s: %w", name, err)
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, values); err != nil {
+		return "", fmt.Errorf("render template %s: %w", name, err)
+	}
+	rendered := out.String()
+	for i, line := range strings.Split(rendered, "\n") {
+		if placeholder := unresolvedPlaceholder.FindString(line); placeholder != "" {
+			return "", fmt.Errorf("template %s: unresolved placeholder %q in line %d", name, placeholder, i+1)
+		}
+	}
+	return rendered, nil
+}
+
+func toYaml(value interface{}) (string, error) {
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// indent prefixes every line of the text with the given number of spaces
+func indent(spaces int, text string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(strings.TrimSuffix(text, "\n"), "\n", "\n"+pad, -1)
+}
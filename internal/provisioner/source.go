@@ -0,0 +1,263 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+//go:embed templates/*.yaml
+var embeddedTemplates embed.FS
+
+// TemplateSet maps template file names (e.g. "controlplane.yaml") to their content
+type TemplateSet map[string]string
+
+// TemplateSource supplies the templates the provisioner renders
+type TemplateSource interface {
+	// Templates returns the current set of templates
+	Templates() (TemplateSet, error)
+}
+
+// replacedTemplates are templates of earlier versions, mapped to the templates that replaced them. A set that still
+// overrides one of them is rejected, since its content would not be rendered anymore.
+var replacedTemplates = map[string][]string{
+	"connector.yaml": {"base.yaml", "controlplane.yaml", "dataplane.yaml"},
+}
+
+// templateLoader loads a complete template set, together with a version that changes whenever the content changes
+type templateLoader func(ctx context.Context) (TemplateSet, string, error)
+
+type embeddedTemplateSource struct {
+	templates TemplateSet
+}
+
+// NewEmbeddedTemplateSource returns the templates that are compiled into the binary
+func NewEmbeddedTemplateSource() TemplateSource {
+	templates := TemplateSet{}
+	entries, err := fs.ReadDir(embeddedTemplates, "templates")
+	if err != nil {
+		log.Fatalf("read embedded templates: %v", err)
+	}
+	for _, entry := range entries {
+		content, err := fs.ReadFile(embeddedTemplates, "templates/"+entry.Name())
+		if err != nil {
+			log.Fatalf("read embedded template %s: %v", entry.Name(), err)
+		}
+		templates[entry.Name()] = string(content)
+	}
+	return &embeddedTemplateSource{templates: templates}
+}
+
+func (e *embeddedTemplateSource) Templates() (TemplateSet, error) {
+	return e.templates, nil
+}
+
+// ReloadingTemplateSource periodically reloads templates from an external location. Templates that are not provided
+// externally are taken from the fallback source, and the last valid set is kept if a reload fails.
+type ReloadingTemplateSource struct {
+	name     string
+	load     templateLoader
+	fallback TemplateSource
+	interval time.Duration
+
+	mutex     sync.RWMutex
+	templates TemplateSet
+	version   string
+	// version of the last set that failed validation, so that it is not reported on every reload
+	rejected string
+}
+
+// NewDirectoryTemplateSource loads all *.yaml files from the given directory
+func NewDirectoryTemplateSource(dir string, fallback TemplateSource, interval time.Duration) *ReloadingTemplateSource {
+	return &ReloadingTemplateSource{
+		name:     "directory " + dir,
+		load:     directoryLoader(dir),
+		fallback: fallback,
+		interval: interval,
+	}
+}
+
+// NewConfigMapTemplateSource loads all *.yaml keys of the given ConfigMap
+func NewConfigMapTemplateSource(kubeClient client.Client, namespace string, name string, fallback TemplateSource, interval time.Duration) *ReloadingTemplateSource {
+	return &ReloadingTemplateSource{
+		name:     "configmap " + namespace + "/" + name,
+		load:     configMapLoader(kubeClient, client.ObjectKey{Namespace: namespace, Name: name}),
+		fallback: fallback,
+		interval: interval,
+	}
+}
+
+// Start loads the templates once and then keeps reloading them in the background until the context is cancelled. It
+// fails if the initial set is rejected, a set that cannot be loaded at all is retried with the next reload.
+func (r *ReloadingTemplateSource) Start(ctx context.Context) error {
+	if err := r.reload(ctx); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(r.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				_ = r.reload(ctx)
+			}
+		}
+	}()
+	return nil
+}
+
+func (r *ReloadingTemplateSource) Templates() (TemplateSet, error) {
+	fallback, err := r.fallback.Templates()
+	if err != nil {
+		return nil, err
+	}
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	merged := TemplateSet{}
+	for name, content := range fallback {
+		merged[name] = content
+	}
+	for name, content := range r.templates {
+		merged[name] = content
+	}
+	return merged, nil
+}
+
+// reload replaces the templates with the current set of the location, and returns an error if the set was rejected
+func (r *ReloadingTemplateSource) reload(ctx context.Context) error {
+	templates, version, err := r.load(ctx)
+	if err != nil {
+		log.Printf("Error loading templates from %s, keeping the current ones: %v\n", r.name, err)
+		return nil
+	}
+	r.mutex.RLock()
+	unchanged := version == r.version || version == r.rejected
+	r.mutex.RUnlock()
+	if unchanged {
+		return nil
+	}
+	if err := validateTemplates(templates); err != nil {
+		log.Printf("Rejected templates of %s, keeping the current ones: %v\n", r.name, err)
+		r.mutex.Lock()
+		r.rejected = version
+		r.mutex.Unlock()
+		return fmt.Errorf("templates of %s: %w", r.name, err)
+	}
+
+	r.mutex.Lock()
+	r.templates = templates
+	r.version = version
+	r.mutex.Unlock()
+	log.Printf("Loaded templates %v from %s\n", templates.names(), r.name)
+	r.warnUnused(templates)
+	return nil
+}
+
+// validateTemplates rejects templates that do not parse, and overrides of templates that were replaced
+func validateTemplates(templates TemplateSet) error {
+	for _, name := range templates.names() {
+		if replacements, found := replacedTemplates[name]; found {
+			return fmt.Errorf("template %s was replaced by %v, its overrides must be split accordingly", name, replacements)
+		}
+		if _, err := template.New(name).Funcs(templateFuncs).Parse(templates[name]); err != nil {
+			return fmt.Errorf("invalid template %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// warnUnused reports templates that no profile renders, most likely overrides of a template that was renamed
+func (r *ReloadingTemplateSource) warnUnused(templates TemplateSet) {
+	used := usedTemplates()
+	for _, name := range templates.names() {
+		if !used[name] {
+			log.Printf("WARNING: template %s in %s is ignored, no profile uses it\n", name, r.name)
+		}
+	}
+}
+
+func directoryLoader(dir string) templateLoader {
+	return func(ctx context.Context) (TemplateSet, string, error) {
+		files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+		if err != nil {
+			return nil, "", err
+		}
+		templates := TemplateSet{}
+		for _, file := range files {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				return nil, "", err
+			}
+			templates[filepath.Base(file)] = string(content)
+		}
+		return templates, templates.hash(), nil
+	}
+}
+
+func configMapLoader(kubeClient client.Client, key client.ObjectKey) templateLoader {
+	return func(ctx context.Context) (TemplateSet, string, error) {
+		configMap := &corev1.ConfigMap{}
+		if err := kubeClient.Get(ctx, key, configMap); err != nil {
+			return nil, "", err
+		}
+		templates := TemplateSet{}
+		for name, content := range configMap.Data {
+			if strings.HasSuffix(name, ".yaml") {
+				templates[name] = content
+			}
+		}
+		return templates, configMap.ResourceVersion, nil
+	}
+}
+
+// Get returns the template with the given name, or an error if the set does not contain it
+func (t TemplateSet) Get(name string) (string, error) {
+	content, ok := t[name]
+	if !ok {
+		return "", fmt.Errorf("template %s not found", name)
+	}
+	return content, nil
+}
+
+func (t TemplateSet) names() []string {
+	names := make([]string, 0, len(t))
+	for name := range t {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Revision is a short form of the hash that fits into a label value
+func (t TemplateSet) Revision() string {
+	return t.hash()[:12]
+}
+
+// hash identifies the content of the template set
+func (t TemplateSet) hash() string {
+	h := sha256.New()
+	for _, name := range t.names() {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+		h.Write([]byte(t[name]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,310 @@
+package provisioner
+
+import (
+	"fmt"
+	"k8s-provisioner/internal/model"
+	"reflect"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// names of the components that can be customized with model.ComponentOverrides
+const (
+	ComponentPostgres     = "postgres"
+	ComponentVault        = "vault"
+	ComponentControlPlane = "controlplane"
+	ComponentDataPlane    = "dataplane"
+	ComponentIdentityHub  = "identityhub"
+)
+
+// TemplateValues contains every value that can be referenced from a provisioning template. It is derived from a
+// model.ParticipantDefinition, everything the definition does not specify is taken from the defaults.
+type TemplateValues struct {
+	Participant  ParticipantValues
+	Ingress      IngressValues
+	Postgres     PostgresValues
+	Vault        VaultValues
+	ControlPlane ControlPlaneValues
+	DataPlane    DataPlaneValues
+	IdentityHub  IdentityHubValues
+}
+
+type ParticipantValues struct {
+	Name      string
+	Id        string
+	Namespace string
+}
+
+type IngressValues struct {
+	ClassName string
+}
+
+// Component contains the values that are common to all deployed components
+type Component struct {
+	Image           string
+	ImagePullPolicy string
+	Replicas        int32
+	Resources       model.ResourceRequirements `values:"optional"`
+}
+
+// HasResources is true if any resource request or limit is set for the component
+func (c Component) HasResources() bool {
+	return c.Resources != model.ResourceRequirements{}
+}
+
+// KubernetesResources converts the resource requests and limits of the component into their Kubernetes representation.
+// Quantities are validated when they are set, so they can be parsed safely here.
+func (c Component) KubernetesResources() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: toResourceList(c.Resources.Requests),
+		Limits:   toResourceList(c.Resources.Limits),
+	}
+}
+
+func toResourceList(list model.ResourceList) corev1.ResourceList {
+	result := corev1.ResourceList{}
+	if list.Cpu != "" {
+		result[corev1.ResourceCPU] = resource.MustParse(list.Cpu)
+	}
+	if list.Memory != "" {
+		result[corev1.ResourceMemory] = resource.MustParse(list.Memory)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+type PostgresValues struct {
+	Component
+	Port             int
+	User             string
+	Password         string
+	Database         string
+	DatabaseUser     string
+	DatabasePassword string
+}
+
+type VaultValues struct {
+	Component
+	Port  int
+	Token string
+}
+
+type ControlPlaneValues struct {
+	Component
+	DefaultPort      int
+	ManagementPort   int
+	ProtocolPort     int
+	ControlPort      int
+	CatalogPort      int
+	DebugPort        int
+	ManagementApiKey string
+	CatalogApiKey    string
+}
+
+type DataPlaneValues struct {
+	Component
+	DefaultPort int
+	ControlPort int
+	PublicPort  int
+	DebugPort   int
+}
+
+type IdentityHubValues struct {
+	Component
+	DefaultPort     int
+	IdentityPort    int
+	CredentialsPort int
+	DidPort         int
+	StsPort         int
+	DebugPort       int
+	IdentityApiKey  string
+	SuperUserKey    string
+}
+
+// DefaultTemplateValues returns the values that are used for everything a participant definition does not specify
+func DefaultTemplateValues() TemplateValues {
+	return TemplateValues{
+		Ingress: IngressValues{
+			ClassName: "nginx",
+		},
+		Postgres: PostgresValues{
+			Component: Component{Image: "postgres:16.3-alpine3.20", ImagePullPolicy: "IfNotPresent", Replicas: 1},
+			Port:      5432,
+			User:      "postgres",
+			Password:  "postgres",
+		},
+		Vault: VaultValues{
+			Component: Component{Image: "hashicorp/vault:1.15.6", ImagePullPolicy: "IfNotPresent", Replicas: 1},
+			Port:      8200,
+			Token:     "root",
+		},
+		ControlPlane: ControlPlaneValues{
+			Component:        Component{Image: "ghcr.io/paullatzelsperger/minimumviabledataspace/controlplane:latest", ImagePullPolicy: "Always", Replicas: 1},
+			DefaultPort:      8080,
+			ManagementPort:   8081,
+			ProtocolPort:     8082,
+			ControlPort:      8083,
+			CatalogPort:      8084,
+			DebugPort:        1044,
+			ManagementApiKey: "password",
+			CatalogApiKey:    "password",
+		},
+		DataPlane: DataPlaneValues{
+			Component:   Component{Image: "ghcr.io/paullatzelsperger/minimumviabledataspace/dataplane:latest", ImagePullPolicy: "Always", Replicas: 1},
+			DefaultPort: 8080,
+			ControlPort: 8083,
+			PublicPort:  11002,
+			DebugPort:   1044,
+		},
+		IdentityHub: IdentityHubValues{
+			Component:       Component{Image: "ghcr.io/paullatzelsperger/minimumviabledataspace/identity-hub:latest", ImagePullPolicy: "Always", Replicas: 1},
+			DefaultPort:     7080,
+			IdentityPort:    7081,
+			CredentialsPort: 7082,
+			DidPort:         7083,
+			StsPort:         7084,
+			DebugPort:       1044,
+			IdentityApiKey:  "password",
+			SuperUserKey:    "c3VwZXItdXNlcg==.c3VwZXItc2VjcmV0LWtleQo=",
+		},
+	}
+}
+
+// NewTemplateValues derives the template values for a participant from the given defaults
+func NewTemplateValues(definition model.ParticipantDefinition, defaults TemplateValues) (TemplateValues, error) {
+	values, err := defaults.WithOverrides(definition.Components)
+	if err != nil {
+		return TemplateValues{}, err
+	}
+	values.Participant = ParticipantValues{
+		Name:      definition.ParticipantName,
+		Id:        definition.Did,
+		Namespace: definition.ParticipantName,
+	}
+	// every participant gets its own database, owned by a user of the same name
+	values.Postgres.Database = definition.ParticipantName
+	values.Postgres.DatabaseUser = definition.ParticipantName
+	values.Postgres.DatabasePassword = definition.ParticipantName
+	return values, nil
+}
+
+// WithOverrides returns a copy of the values in which the given components are customized. Only the fields that are
+// set on an override replace the existing values.
+func (v TemplateValues) WithOverrides(overrides map[string]model.ComponentOverrides) (TemplateValues, error) {
+	names := make([]string, 0, len(overrides))
+	for name := range overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		component := v.component(name)
+		if component == nil {
+			return v, fmt.Errorf("unknown component %q", name)
+		}
+		if err := applyOverrides(component, overrides[name]); err != nil {
+			return v, fmt.Errorf("component %s: %w", name, err)
+		}
+	}
+	return v, nil
+}
+
+func (v *TemplateValues) component(name string) *Component {
+	switch name {
+	case ComponentPostgres:
+		return &v.Postgres.Component
+	case ComponentVault:
+		return &v.Vault.Component
+	case ComponentControlPlane:
+		return &v.ControlPlane.Component
+	case ComponentDataPlane:
+		return &v.DataPlane.Component
+	case ComponentIdentityHub:
+		return &v.IdentityHub.Component
+	}
+	return nil
+}
+
+func applyOverrides(component *Component, overrides model.ComponentOverrides) error {
+	if overrides.Image != "" {
+		component.Image = overrides.Image
+	}
+	if overrides.ImagePullPolicy != "" {
+		switch corev1.PullPolicy(overrides.ImagePullPolicy) {
+		case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+			component.ImagePullPolicy = overrides.ImagePullPolicy
+		default:
+			return fmt.Errorf("invalid image pull policy %q", overrides.ImagePullPolicy)
+		}
+	}
+	if overrides.Replicas != nil {
+		if *overrides.Replicas < 1 {
+			return fmt.Errorf("replicas must be at least 1, got %d", *overrides.Replicas)
+		}
+		component.Replicas = *overrides.Replicas
+	}
+	if overrides.Resources != nil {
+		requests, err := mergeResourceList(component.Resources.Requests, overrides.Resources.Requests)
+		if err != nil {
+			return fmt.Errorf("resource requests: %w", err)
+		}
+		limits, err := mergeResourceList(component.Resources.Limits, overrides.Resources.Limits)
+		if err != nil {
+			return fmt.Errorf("resource limits: %w", err)
+		}
+		component.Resources = model.ResourceRequirements{Requests: requests, Limits: limits}
+	}
+	return nil
+}
+
+func mergeResourceList(current model.ResourceList, overrides model.ResourceList) (model.ResourceList, error) {
+	if overrides.Cpu != "" {
+		if _, err := resource.ParseQuantity(overrides.Cpu); err != nil {
+			return current, fmt.Errorf("invalid cpu quantity %q", overrides.Cpu)
+		}
+		current.Cpu = overrides.Cpu
+	}
+	if overrides.Memory != "" {
+		if _, err := resource.ParseQuantity(overrides.Memory); err != nil {
+			return current, fmt.Errorf("invalid memory quantity %q", overrides.Memory)
+		}
+		current.Memory = overrides.Memory
+	}
+	return current, nil
+}
+
+// Validate checks that every value is set, and returns an error listing all missing values otherwise
+func (v TemplateValues) Validate() error {
+	var missing []string
+	collectMissing(reflect.ValueOf(v), "", &missing)
+	if len(missing) > 0 {
+		return fmt.Errorf("missing template values: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+func collectMissing(value reflect.Value, path string, missing *[]string) {
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		fieldValue := value.Field(i)
+		if field.Tag.Get("values") == "optional" {
+			continue
+		}
+		fieldPath := field.Name
+		if field.Anonymous {
+			fieldPath = path
+		} else if path != "" {
+			fieldPath = path + "." + field.Name
+		}
+		if fieldValue.Kind() == reflect.Struct {
+			collectMissing(fieldValue, fieldPath, missing)
+		} else if fieldValue.IsZero() {
+			*missing = append(*missing, fieldPath)
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package readiness
+
+import (
+	"context"
+	"fmt"
+	"k8s-provisioner/internal/kube"
+	"net/http"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// todo: make configurable
+const (
+	pollInterval = 2 * time.Second
+	httpTimeout  = 5 * time.Second
+)
+
+// Gate is a condition that must hold before the resources of a participant are considered ready
+type Gate interface {
+	// Name identifies the gate in messages, e.g. "service/controlplane"
+	Name() string
+	// Check reports whether the gate passes right now. A *kube.ReadinessError means that it will not pass without
+	// intervention.
+	Check(ctx context.Context) (bool, error)
+}
+
+// waiter is implemented by gates that can wait more efficiently than by polling Check
+type waiter interface {
+	Wait(ctx context.Context) error
+}
+
+// Wait blocks until all gates passed, or returns the first failure. Gates that do not pass before the context expires
+// fail with a ReadinessError.
+func Wait(ctx context.Context, namespace string, gates []Gate) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	errCh := make(chan error, len(gates))
+	for _, gate := range gates {
+		go func() {
+			errCh <- wait(ctx, namespace, gate)
+		}()
+	}
+	var firstErr error
+	for range gates {
+		if err := <-errCh; err != nil && firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	return firstErr
+}
+
+// Passed checks all gates once and returns the names of those that pass, or the first gate that failed. Gates that
+// cannot be checked right now count as not passed.
+func Passed(ctx context.Context, gates []Gate) ([]string, *kube.ReadinessError) {
+	var passed []string
+	for _, gate := range gates {
+		ok, err := gate.Check(ctx)
+		if failure, failed := err.(*kube.ReadinessError); failed {
+			return nil, failure
+		}
+		if ok {
+			passed = append(passed, gate.Name())
+		}
+	}
+	return passed, nil
+}
+
+func wait(ctx context.Context, namespace string, gate Gate) error {
+	if w, ok := gate.(waiter); ok {
+		return w.Wait(ctx)
+	}
+	for {
+		ok, err := gate.Check(ctx)
+		if ok {
+			return nil
+		}
+		if _, failed := err.(*kube.ReadinessError); failed {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			if ctx.Err() != context.DeadlineExceeded {
+				return ctx.Err()
+			}
+			message := gate.Name() + " did not pass in time"
+			if err != nil {
+				message += ": " + err.Error()
+			}
+			return &kube.ReadinessError{Namespace: namespace, Reason: kube.ReasonTimeout, Message: message}
+		case <-time.After(pollInterval):
+			continue
+		}
+	}
+}
+
+// DeploymentGate passes once the deployment has rolled out all replicas of its current generation
+type DeploymentGate struct {
+	Client     client.Client
+	Namespace  string
+	Deployment string
+	// Generation is the generation that was applied, if known. The gate does not pass before it has been observed.
+	Generation int64
+}
+
+func (g DeploymentGate) Name() string {
+	return "deployment/" + g.Deployment
+}
+
+func (g DeploymentGate) Check(ctx context.Context) (bool, error) {
+	deployment := &appsv1.Deployment{}
+	if err := g.Client.Get(ctx, client.ObjectKey{Namespace: g.Namespace, Name: g.Deployment}, deployment); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if deployment.Status.ObservedGeneration >= g.Generation && kube.DeploymentReady(deployment) {
+		return true, nil
+	}
+	failure, err := kube.DeploymentFailure(g.Client, ctx, deployment)
+	if failure != nil {
+		return false, failure
+	}
+	return false, err
+}
+
+// Wait uses the deployment wait of the kube package, which is driven by the readiness tracker if the client is tracked
+func (g DeploymentGate) Wait(ctx context.Context) error {
+	return kube.WaitForDeployment(g.Client, ctx, g.Namespace, g.Deployment, g.Generation)
+}
+
+// StatefulSetGate passes once all replicas of the stateful set are updated, ready and available
+type StatefulSetGate struct {
+	Client      client.Client
+	Namespace   string
+	StatefulSet string
+	// Generation is the generation that was applied, if known. The gate does not pass before it has been observed.
+	Generation int64
+}
+
+func (g StatefulSetGate) Name() string {
+	return "statefulset/" + g.StatefulSet
+}
+
+func (g StatefulSetGate) Check(ctx context.Context) (bool, error) {
+	statefulSet := &appsv1.StatefulSet{}
+	if err := g.Client.Get(ctx, client.ObjectKey{Namespace: g.Namespace, Name: g.StatefulSet}, statefulSet); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	desired := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		desired = *statefulSet.Spec.Replicas
+	}
+	status := statefulSet.Status
+	return status.ObservedGeneration >= max(statefulSet.Generation, g.Generation) &&
+		status.UpdatedReplicas == desired &&
+		status.ReadyReplicas == desired &&
+		status.AvailableReplicas == desired, nil
+}
+
+// ServiceEndpointsGate passes once the service has at least one ready endpoint
+type ServiceEndpointsGate struct {
+	Client    client.Client
+	Namespace string
+	Service   string
+}
+
+func (g ServiceEndpointsGate) Name() string {
+	return "service/" + g.Service
+}
+
+func (g ServiceEndpointsGate) Check(ctx context.Context) (bool, error) {
+	slices := &discoveryv1.EndpointSliceList{}
+	err := g.Client.List(ctx, slices, client.InNamespace(g.Namespace), client.MatchingLabels{discoveryv1.LabelServiceName: g.Service})
+	if err != nil {
+		return false, err
+	}
+	for _, slice := range slices.Items {
+		for _, endpoint := range slice.Endpoints {
+			if endpoint.Conditions.Ready == nil || *endpoint.Conditions.Ready {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// IngressAddressGate passes once the ingress controller has assigned an address to the ingress
+type IngressAddressGate struct {
+	Client    client.Client
+	Namespace string
+	Ingress   string
+}
+
+func (g IngressAddressGate) Name() string {
+	return "ingress/" + g.Ingress
+}
+
+func (g IngressAddressGate) Check(ctx context.Context) (bool, error) {
+	ingress := &networkingv1.Ingress{}
+	err := g.Client.Get(ctx, client.ObjectKey{Namespace: g.Namespace, Name: g.Ingress}, ingress)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, address := range ingress.Status.LoadBalancer.Ingress {
+		if address.IP != "" || address.Hostname != "" {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HTTPGate passes once a GET request to the URL succeeds with a 2xx status
+type HTTPGate struct {
+	URL string
+}
+
+func (g HTTPGate) Name() string {
+	return "http " + g.URL
+}
+
+func (g HTTPGate) Check(ctx context.Context) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, httpTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, g.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		return false, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return false, fmt.Errorf("status %d", response.StatusCode)
+	}
+	return true, nil
+}
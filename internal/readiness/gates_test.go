@@ -0,0 +1,167 @@
+package readiness
+
+import (
+	"context"
+	"k8s-provisioner/internal/kube"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const namespace = "alice"
+
+var labels = map[string]string{"app": "controlplane"}
+
+func fakeClient(t *testing.T, objects ...client.Object) client.Client {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	return fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+}
+
+func deployment(generation int64, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "controlplane", Generation: generation},
+		Spec:       appsv1.DeploymentSpec{Selector: &metav1.LabelSelector{MatchLabels: labels}},
+		Status:     status,
+	}
+}
+
+func rolledOut(generation int64) appsv1.DeploymentStatus {
+	return appsv1.DeploymentStatus{ObservedGeneration: generation, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+}
+
+func crashLoopingPod() *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "controlplane-abc", Labels: labels},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:         "controlplane",
+			RestartCount: 10,
+			State:        corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: kube.ReasonCrashLoopBackOff}},
+		}}},
+	}
+}
+
+func TestDeploymentGateCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		objects     []client.Object
+		generation  int64
+		wantPassed  bool
+		wantFailure string
+	}{
+		{
+			name:       "rolled out",
+			objects:    []client.Object{deployment(2, rolledOut(2))},
+			generation: 2,
+			wantPassed: true,
+		},
+		{
+			name:       "applied generation not observed",
+			objects:    []client.Object{deployment(3, rolledOut(2))},
+			generation: 3,
+		},
+		{
+			name:       "applied generation unknown",
+			objects:    []client.Object{deployment(2, rolledOut(2))},
+			wantPassed: true,
+		},
+		{
+			name:    "not created yet",
+			objects: nil,
+		},
+		{
+			name:    "rolling out",
+			objects: []client.Object{deployment(1, appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1, UpdatedReplicas: 1})},
+		},
+		{
+			name: "progress deadline exceeded",
+			objects: []client.Object{deployment(1, appsv1.DeploymentStatus{
+				ObservedGeneration: 1,
+				Conditions: []appsv1.DeploymentCondition{{
+					Type:   appsv1.DeploymentProgressing,
+					Status: corev1.ConditionFalse,
+					Reason: kube.ReasonProgressDeadlineExceeded,
+				}},
+			})},
+			wantFailure: kube.ReasonProgressDeadlineExceeded,
+		},
+		{
+			name:        "crash looping pod",
+			objects:     []client.Object{deployment(1, appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 1}), crashLoopingPod()},
+			wantFailure: kube.ReasonCrashLoopBackOff,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gate := DeploymentGate{
+				Client:     fakeClient(t, test.objects...),
+				Namespace:  namespace,
+				Deployment: "controlplane",
+				Generation: test.generation,
+			}
+			passed, err := gate.Check(context.Background())
+			if passed != test.wantPassed {
+				t.Errorf("Check() passed = %v, want %v", passed, test.wantPassed)
+			}
+			failure, failed := err.(*kube.ReadinessError)
+			switch {
+			case test.wantFailure == "" && err != nil:
+				t.Errorf("Check() error = %v, want none", err)
+			case test.wantFailure != "" && (!failed || failure.Reason != test.wantFailure):
+				t.Errorf("Check() error = %v, want reason %s", err, test.wantFailure)
+			}
+		})
+	}
+}
+
+func TestStatefulSetGateCheck(t *testing.T) {
+	statefulSet := func(generation int64, status appsv1.StatefulSetStatus) *appsv1.StatefulSet {
+		return &appsv1.StatefulSet{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "vault", Generation: generation},
+			Status:     status,
+		}
+	}
+	ready := appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1, AvailableReplicas: 1}
+
+	tests := []struct {
+		name       string
+		objects    []client.Object
+		generation int64
+		want       bool
+	}{
+		{name: "rolled out", objects: []client.Object{statefulSet(2, ready)}, generation: 2, want: true},
+		{name: "applied generation unknown", objects: []client.Object{statefulSet(2, ready)}, want: true},
+		{name: "applied generation not observed", objects: []client.Object{statefulSet(2, ready)}, generation: 3},
+		{name: "current generation not observed", objects: []client.Object{statefulSet(3, ready)}},
+		{
+			name:    "replica not available",
+			objects: []client.Object{statefulSet(2, appsv1.StatefulSetStatus{ObservedGeneration: 2, Replicas: 1, UpdatedReplicas: 1, ReadyReplicas: 1})},
+		},
+		{name: "not created yet", objects: nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gate := StatefulSetGate{
+				Client:      fakeClient(t, test.objects...),
+				Namespace:   namespace,
+				StatefulSet: "vault",
+				Generation:  test.generation,
+			}
+			got, err := gate.Check(context.Background())
+			if err != nil {
+				t.Fatalf("Check() error = %v", err)
+			}
+			if got != test.want {
+				t.Errorf("Check() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package seed
 
 import (
 	_ "embed"
+	"fmt"
 	"k8s-provisioner/clients/config"
 	clients "k8s-provisioner/clients/management"
 	"k8s-provisioner/internal/model"
@@ -32,7 +33,8 @@ var defRequireMembership string
 //go:embed resources/contractdef_require_sensitive.json
 var defSensitive string
 
-func ConnectorData(definition model.ParticipantDefinition) {
+// ConnectorData creates the assets, policies and contract definitions of a participant in its control plane
+func ConnectorData(definition model.ParticipantDefinition) error {
 
 	kubernetesHost := definition.KubernetesIngressHost
 	namespace := definition.ParticipantName
@@ -49,8 +51,7 @@ func ConnectorData(definition model.ParticipantDefinition) {
 	for _, asset := range []string{asset1Json, asset2json} {
 		_, err := mgmtApi.CreateAsset(asset)
 		if err != nil {
-			log.Println(err)
-			return
+			return fmt.Errorf("create asset: %w", err)
 		}
 
 	}
@@ -60,8 +61,7 @@ func ConnectorData(definition model.ParticipantDefinition) {
 	for _, policy := range []string{policyDataProcessorJson, policyMembershipJson, policySensitiveDataJson} {
 		_, err := mgmtApi.CreatePolicy(policy)
 		if err != nil {
-			log.Println(err)
-			return
+			return fmt.Errorf("create policy: %w", err)
 		}
 	}
 	log.Println("policies created")
@@ -70,10 +70,9 @@ func ConnectorData(definition model.ParticipantDefinition) {
 	for _, cd := range []string{defRequireMembership, defSensitive} {
 		_, err := mgmtApi.CreateContractDefinition(cd)
 		if err != nil {
-			log.Println(err)
-			return
+			return fmt.Errorf("create contract definition: %w", err)
 		}
 	}
 	log.Println("contract definitions created")
-
+	return nil
 }
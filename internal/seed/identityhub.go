@@ -15,7 +15,8 @@ import (
 //go:embed templates/participant.json
 var participantJson string
 
-func IdentityHubData(definition model.ParticipantDefinition) {
+// IdentityHubData creates the participant context in the IdentityHub and stores its STS client secret in the vault
+func IdentityHubData(definition model.ParticipantDefinition) error {
 	kubernetesHost := definition.KubernetesIngressHost
 	namespace := definition.ParticipantName
 
@@ -38,12 +39,11 @@ func IdentityHubData(definition model.ParticipantDefinition) {
 
 	participant, err := identityApi.CreateParticipant(body)
 	if err != nil {
-		log.Println(err)
-		return
+		return fmt.Errorf("create identityhub participant: %w", err)
 	}
 	if participant == nil {
 		log.Println("participant already exists")
-		return
+		return nil
 	}
 
 	var mgmtApi = mgmt.ManagementApiClient{
@@ -66,8 +66,8 @@ func IdentityHubData(definition model.ParticipantDefinition) {
 
 	_, err = mgmtApi.CreateSecret(secretBody)
 	if err != nil {
-		log.Println(err)
-		return
+		return fmt.Errorf("create sts client secret: %w", err)
 	}
 	log.Println("participant created")
+	return nil
 }
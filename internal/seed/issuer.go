@@ -2,13 +2,15 @@ package seed
 
 import (
 	"encoding/base64"
+	"fmt"
 	"k8s-provisioner/clients/config"
 	"k8s-provisioner/clients/issuer"
 	"k8s-provisioner/internal/model"
 	"log"
 )
 
-func IssuerData(definition model.ParticipantDefinition) {
+// IssuerData registers the participant as a holder at the issuer service
+func IssuerData(definition model.ParticipantDefinition) error {
 	kubernetesHost := definition.KubernetesIngressHost
 	issuerId := "did:web:dataspace-issuer-service.poc-issuer.svc.cluster.local%3A10016:issuer"
 	issuerB64 := base64.StdEncoding.EncodeToString([]byte(issuerId))
@@ -22,8 +24,8 @@ func IssuerData(definition model.ParticipantDefinition) {
 
 	err := issuerApi.CreateHolder(definition.Did, definition.Did, definition.ParticipantName)
 	if err != nil {
-		log.Println(err)
-		return
+		return fmt.Errorf("create issuer holder: %w", err)
 	}
 	log.Println("issuer account created for participant ", definition.ParticipantName)
+	return nil
 }
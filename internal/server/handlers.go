@@ -1,14 +1,17 @@
 package server
 
 import (
+	"errors"
+	"k8s-provisioner/internal/jobs"
 	"k8s-provisioner/internal/model"
 	"k8s-provisioner/internal/provisioner"
+	"k8s-provisioner/internal/upgrade"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func CreateResource(provisioningAgent provisioner.ProvisioningAgent, onDeploymentReady func(definition model.ParticipantDefinition)) func(c *fiber.Ctx) error {
+func CreateResource(provisioningAgent provisioner.ProvisioningAgent, onDeploymentReady func(definition model.ParticipantDefinition) error) func(c *fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		definition := model.ParticipantDefinition{
 			KubernetesIngressHost: "localhost",
@@ -16,9 +19,20 @@ func CreateResource(provisioningAgent provisioner.ProvisioningAgent, onDeploymen
 		if err := c.BodyParser(&definition); err != nil {
 			return err
 		}
+		if err := definition.Validate(); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
 
 		log.Println("Creating resources")
-		mergedResources, err2 := provisioningAgent.CreateResources(definition, onDeploymentReady)
+		mergedResources, err2 := provisioningAgent.CreateResources(definition, func(definition model.ParticipantDefinition, err error) {
+			if err != nil {
+				log.Printf("Resources of participant %s did not become ready: %v\n", definition.ParticipantName, err)
+				return
+			}
+			if err := onDeploymentReady(definition); err != nil {
+				log.Printf("Seeding data of participant %s failed: %v\n", definition.ParticipantName, err)
+			}
+		})
 		if err2 != nil {
 			return err2
 		}
@@ -43,3 +57,131 @@ func DeleteResource(provisioningAgent provisioner.ProvisioningAgent) func(c *fib
 		return c.JSON(mergedResources)
 	}
 }
+
+func PlanResource(provisioningAgent provisioner.ProvisioningAgent) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		definition := model.ParticipantDefinition{
+			KubernetesIngressHost: "localhost",
+		}
+		if err := c.BodyParser(&definition); err != nil {
+			return err
+		}
+
+		var changes []model.ObjectChange
+		var err error
+		switch action := c.Query("action", "create"); action {
+		case "create":
+			if err := definition.Validate(); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+			log.Println("Planning resource creation")
+			changes, err = provisioningAgent.PlanCreateResources(definition)
+		case "delete":
+			log.Println("Planning resource deletion")
+			changes, err = provisioningAgent.PlanDeleteResources(definition)
+		default:
+			return fiber.NewError(fiber.StatusBadRequest, "unknown action '"+action+"', expected 'create' or 'delete'")
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(changes)
+	}
+}
+
+func GetHistory(provisioningAgent provisioner.ProvisioningAgent) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		history, err := provisioningAgent.History(c.Params("name"))
+		if err != nil {
+			return err
+		}
+		return c.JSON(history)
+	}
+}
+
+// RollbackResource starts the rollback of a participant and returns right away, since the rollback lasts until the
+// participant is ready again. Its progress is reported by GetRollback.
+func RollbackResource(rollbacks *upgrade.Rollbacks) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		name := c.Params("name")
+		version := c.QueryInt("version", 0)
+		if version < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "version must not be negative")
+		}
+
+		log.Println("Rolling back resources of", name)
+		status, err := rollbacks.Start(name, version)
+		if errors.Is(err, upgrade.ErrRollbackRunning) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(status)
+	}
+}
+
+func GetRollback(rollbacks *upgrade.Rollbacks) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		status, found := rollbacks.Status(c.Params("name"))
+		if !found {
+			return fiber.NewError(fiber.StatusNotFound, "no rollback of the participant has been started")
+		}
+		return c.JSON(status)
+	}
+}
+
+// RequireLeader rejects requests with 503 on replicas that are not the leader, for operations that must not run on
+// several replicas at the same time
+func RequireLeader(isLeader func() bool) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if !isLeader() {
+			return fiber.NewError(fiber.StatusServiceUnavailable, "this replica is not the leader, retry against the leader")
+		}
+		return c.Next()
+	}
+}
+
+// NotifyJobs receives notifications about new Fulcrum jobs, which must be signed with the shared webhook secret
+func NotifyJobs(webhook *jobs.WebhookSource) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if err := webhook.Notify(c.Body(), c.Get(jobs.SignatureHeader)); err != nil {
+			return fiber.NewError(fiber.StatusUnauthorized, err.Error())
+		}
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+}
+
+func StartUpgrade(upgrader *upgrade.Upgrader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		var request model.UpgradeRequest
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&request); err != nil {
+				return err
+			}
+		}
+
+		log.Println("Starting upgrade")
+		status, err := upgrader.Start(request)
+		if errors.Is(err, upgrade.ErrUpgradeRunning) {
+			return fiber.NewError(fiber.StatusConflict, err.Error())
+		}
+		if err != nil {
+			return err
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(status)
+	}
+}
+
+func GetUpgrade(upgrader *upgrade.Upgrader) func(c *fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		status, found := upgrader.Status()
+		if !found {
+			return fiber.NewError(fiber.StatusNotFound, "no upgrade has been started")
+		}
+		return c.JSON(status)
+	}
+}
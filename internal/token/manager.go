@@ -0,0 +1,255 @@
+package token
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"k8s-provisioner/clients/fulcrum"
+	"k8s-provisioner/internal/model"
+	"log"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+)
+
+// keys of the token Secret
+const (
+	tokenKey    = "token"
+	idKey       = "id"
+	expireAtKey = "expireAt"
+)
+
+// todo: make configurable
+const (
+	retryInterval = time.Minute
+	// minRotationInterval bounds how often tokens are issued, e.g. if the expiry of the current one is unknown
+	minRotationInterval = time.Minute
+)
+
+// Options configure the tokens a Manager issues
+type Options struct {
+	// Lifetime is how long a newly issued token is valid
+	Lifetime time.Duration
+	// RotateBefore is how long before its expiry a token is replaced by a new one
+	RotateBefore time.Duration
+}
+
+// Manager provides the agent token of the provisioner. It adopts an existing token if it is still valid, persists every
+// token it issues in a Secret, so that restarts and other replicas reuse it, and issues a new token before the current
+// one expires. Tokens are never regenerated, since that would invalidate them for everyone else holding them.
+type Manager struct {
+	apiClient  clients.FulcrumApi
+	kubeClient client.Client
+	secret     client.ObjectKey
+	name       string
+	options    Options
+
+	mutex   sync.RWMutex
+	agentId string
+	value   string
+	// id of the current token, empty if it was not issued by a Manager
+	id       string
+	expireAt time.Time
+}
+
+func NewManager(apiClient clients.FulcrumApi, kubeClient client.Client, secret client.ObjectKey, name string, options Options) (*Manager, error) {
+	if options.Lifetime <= 0 {
+		return nil, fmt.Errorf("token lifetime must be positive, got %s", options.Lifetime)
+	}
+	if options.RotateBefore >= options.Lifetime {
+		return nil, fmt.Errorf("tokens are rotated %s before they expire, which must be less than their lifetime of %s", options.RotateBefore, options.Lifetime)
+	}
+	return &Manager{
+		apiClient:  apiClient,
+		kubeClient: kubeClient,
+		secret:     secret,
+		name:       name,
+		options:    options,
+	}, nil
+}
+
+// Token returns the current agent token
+func (m *Manager) Token() string {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.value
+}
+
+// Init selects the token of the agent: the given token if it is valid, e.g. one passed in the environment, otherwise
+// the one persisted in the Secret, otherwise a newly issued one
+func (m *Manager) Init(ctx context.Context, agentId string, token string) error {
+	m.mutex.Lock()
+	m.agentId = agentId
+	m.mutex.Unlock()
+
+	if token != "" && m.valid(token) {
+		log.Println("Using the agent token from the configuration")
+		expireAt, err := m.expiry(agentId)
+		if err != nil {
+			return err
+		}
+		m.set(token, "", expireAt)
+		return nil
+	}
+	value, id, expireAt, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	if value != "" && m.valid(value) {
+		log.Println("Using the agent token from Secret", m.secret)
+		if expireAt.IsZero() {
+			if expireAt, err = m.expiry(agentId); err != nil {
+				return err
+			}
+		}
+		m.set(value, id, expireAt)
+		return nil
+	}
+	return m.issue(ctx)
+}
+
+// Start rotates the token in the background, until the context is done
+func (m *Manager) Start(ctx context.Context) {
+	go func() {
+		for {
+			m.mutex.RLock()
+			wait := time.Until(m.expireAt.Add(-m.options.RotateBefore))
+			m.mutex.RUnlock()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(max(wait, minRotationInterval)):
+			}
+			if err := m.rotate(ctx); err != nil {
+				log.Printf("Error rotating agent token: %v\n", err)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(retryInterval):
+				}
+			}
+		}
+	}()
+}
+
+// rotate adopts a newer token that another replica persisted in the meantime, or issues a new one
+func (m *Manager) rotate(ctx context.Context) error {
+	value, id, expireAt, err := m.load(ctx)
+	if err != nil {
+		return err
+	}
+	if value != "" && value != m.Token() && time.Until(expireAt) > m.options.RotateBefore && m.valid(value) {
+		log.Println("Adopting the rotated agent token from Secret", m.secret)
+		m.set(value, id, expireAt)
+		return nil
+	}
+	return m.issue(ctx)
+}
+
+// issue creates a new token and persists it. The previous token is revoked once the new one is persisted, unless it
+// was not issued by a Manager, since then it is not known which of the agent's tokens it is.
+func (m *Manager) issue(ctx context.Context) error {
+	m.mutex.RLock()
+	agentId, previousId := m.agentId, m.id
+	m.mutex.RUnlock()
+
+	log.Println("  > creating agent token")
+	token, err := m.apiClient.CreateAgentToken(agentId, m.name, time.Now().Add(m.options.Lifetime))
+	if err != nil {
+		return fmt.Errorf("failed to create agent token: %w", err)
+	}
+	m.set(token.Value, token.Id, token.ExpireAt)
+	log.Println("Issued agent token, valid until", token.ExpireAt.Format(time.RFC3339))
+	if err := m.store(ctx, token.Value, token.Id, token.ExpireAt); err != nil {
+		// the token works nevertheless, but the next restart issues another one. The previous token is kept, since it
+		// is still the one in the Secret.
+		log.Printf("Error persisting agent token in Secret %s: %v\n", m.secret, err)
+		return nil
+	}
+	if previousId != "" && previousId != token.Id {
+		if err := m.apiClient.DeleteToken(previousId); err != nil {
+			// it expires nevertheless
+			log.Printf("Error revoking previous agent token %s: %v\n", previousId, err)
+		} else {
+			log.Println("Revoked previous agent token", previousId)
+		}
+	}
+	return nil
+}
+
+func (m *Manager) set(value string, id string, expireAt time.Time) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.value = value
+	m.id = id
+	m.expireAt = expireAt
+}
+
+// valid checks whether Fulcrum Core accepts the token
+func (m *Manager) valid(token string) bool {
+	_, err := m.apiClient.GetPendingJobs(token)
+	return err == nil
+}
+
+// expiry returns the earliest expiry of the agent's tokens that are still valid, since it is not known which of them
+// the current token is. The token is rotated right away if none is found.
+func (m *Manager) expiry(agentId string) (time.Time, error) {
+	tokens, err := m.apiClient.ListTokens()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to list tokens: %w", err)
+	}
+	var earliest time.Time
+	for _, token := range tokens {
+		if !m.ownToken(token, agentId) || token.ExpireAt.Before(time.Now()) {
+			continue
+		}
+		if earliest.IsZero() || token.ExpireAt.Before(earliest) {
+			earliest = token.ExpireAt
+		}
+	}
+	return earliest, nil
+}
+
+func (m *Manager) ownToken(token model.TokenInformation, agentId string) bool {
+	return token.Name == m.name && (token.AgentId == "" || token.AgentId == agentId)
+}
+
+// load reads the persisted token and its id, an empty value means there is none
+func (m *Manager) load(ctx context.Context) (string, string, time.Time, error) {
+	if m.secret.Name == "" {
+		return "", "", time.Time{}, nil
+	}
+	secret := &corev1.Secret{}
+	err := m.kubeClient.Get(ctx, m.secret, secret)
+	if client.IgnoreNotFound(err) != nil {
+		return "", "", time.Time{}, fmt.Errorf("read token Secret %s: %w", m.secret, err)
+	}
+	if err != nil {
+		return "", "", time.Time{}, nil
+	}
+	// the id and expiry are unknown for tokens that were put into the Secret by hand
+	expireAt, _ := time.Parse(time.RFC3339, string(secret.Data[expireAtKey]))
+	return string(secret.Data[tokenKey]), string(secret.Data[idKey]), expireAt, nil
+}
+
+func (m *Manager) store(ctx context.Context, value string, id string, expireAt time.Time) error {
+	if m.secret.Name == "" {
+		return errors.New("no token Secret configured")
+	}
+	secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: m.secret.Namespace, Name: m.secret.Name}}
+	_, err := controllerutil.CreateOrUpdate(ctx, m.kubeClient, secret, func() error {
+		if secret.Data == nil {
+			secret.Data = map[string][]byte{}
+		}
+		secret.Data[tokenKey] = []byte(value)
+		secret.Data[idKey] = []byte(id)
+		secret.Data[expireAtKey] = []byte(expireAt.UTC().Format(time.RFC3339))
+		return nil
+	})
+	return err
+}
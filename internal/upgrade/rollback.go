@@ -0,0 +1,84 @@
+package upgrade
+
+import (
+	"errors"
+	"fmt"
+	"k8s-provisioner/internal/kube"
+	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/provisioner"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrRollbackRunning is returned when a rollback is requested for a participant that is still being rolled back
+var ErrRollbackRunning = errors.New("a rollback of the participant is already running")
+
+// Rollbacks rolls participants back in the background, since that lasts until their deployments are ready again. The
+// status of the last rollback of each participant is kept.
+type Rollbacks struct {
+	agent provisioner.ProvisioningAgent
+
+	mutex  sync.Mutex
+	status map[string]*model.RollbackStatus
+}
+
+func NewRollbacks(agent provisioner.ProvisioningAgent) *Rollbacks {
+	return &Rollbacks{
+		agent:  agent,
+		status: map[string]*model.RollbackStatus{},
+	}
+}
+
+// Start rolls the participant back to the given version of its history in the background, 0 selects the version
+// before the latest one
+func (r *Rollbacks) Start(participantName string, version int) (model.RollbackStatus, error) {
+	if version < 0 {
+		return model.RollbackStatus{}, fmt.Errorf("version must not be negative")
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if status, found := r.status[participantName]; found && status.State == StateRunning {
+		return model.RollbackStatus{}, ErrRollbackRunning
+	}
+	status := &model.RollbackStatus{
+		Participant: participantName,
+		Version:     version,
+		State:       StateRunning,
+		StartedAt:   time.Now(),
+	}
+	r.status[participantName] = status
+
+	go func() {
+		resources, err := r.agent.RollbackResources(participantName, version)
+		r.mutex.Lock()
+		defer r.mutex.Unlock()
+		now := time.Now()
+		status.FinishedAt = &now
+		if err != nil {
+			log.Printf("Rollback of participant %s failed: %v\n", participantName, err)
+			status.State = StateFailed
+			status.Error = err.Error()
+			var readinessError *kube.ReadinessError
+			if errors.As(err, &readinessError) {
+				status.Reason = readinessError.Reason
+			}
+			return
+		}
+		log.Println("Rolled back participant", participantName)
+		status.State = StateSucceeded
+		status.Resources = resources
+	}()
+	return *status, nil
+}
+
+// Status returns the progress of the current or last rollback of the participant, false if there has not been one
+func (r *Rollbacks) Status(participantName string) (model.RollbackStatus, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	status, found := r.status[participantName]
+	if !found {
+		return model.RollbackStatus{}, false
+	}
+	return *status, true
+}
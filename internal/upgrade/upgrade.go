@@ -0,0 +1,278 @@
+package upgrade
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"k8s-provisioner/internal/kube"
+	"k8s-provisioner/internal/model"
+	"k8s-provisioner/internal/provisioner"
+	"k8s-provisioner/internal/readiness"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// states of an upgrade
+const (
+	StateRunning   = "running"
+	StateSucceeded = "succeeded"
+	StateFailed    = "failed"
+	// StateHalted means the upgrade stopped after a failure, some participants were not upgraded
+	StateHalted = "halted"
+)
+
+// states of a single participant within an upgrade
+const (
+	ParticipantPending   = "pending"
+	ParticipantUpgrading = "upgrading"
+	ParticipantSucceeded = "succeeded"
+	ParticipantFailed    = "failed"
+	ParticipantSkipped   = "skipped"
+)
+
+// todo: make configurable
+const (
+	defaultConcurrency      = 4
+	defaultReadinessTimeout = 10 * time.Minute
+)
+
+// ErrUpgradeRunning is returned when an upgrade is requested while another one is still in progress
+var ErrUpgradeRunning = errors.New("an upgrade is already running")
+
+// Upgrader re-applies the current templates to all provisioned participants and verifies that their deployments
+// become ready again. Only one upgrade runs at a time.
+type Upgrader struct {
+	ctx        context.Context
+	kubeClient client.Client
+	agent      provisioner.ProvisioningAgent
+
+	mutex  sync.Mutex
+	status *model.UpgradeStatus
+}
+
+func NewUpgrader(ctx context.Context, kubeClient client.Client, agent provisioner.ProvisioningAgent) *Upgrader {
+	return &Upgrader{
+		ctx:        ctx,
+		kubeClient: kubeClient,
+		agent:      agent,
+	}
+}
+
+// Start discovers the participants to upgrade and upgrades them in the background
+func (u *Upgrader) Start(request model.UpgradeRequest) (model.UpgradeStatus, error) {
+	if request.Concurrency <= 0 {
+		request.Concurrency = defaultConcurrency
+	}
+	if request.CanarySize < 0 {
+		return model.UpgradeStatus{}, fmt.Errorf("canarySize must not be negative")
+	}
+	if request.ReadinessTimeoutSeconds < 0 {
+		return model.UpgradeStatus{}, fmt.Errorf("readinessTimeoutSeconds must not be negative")
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.status != nil && u.status.State == StateRunning {
+		return model.UpgradeStatus{}, ErrUpgradeRunning
+	}
+
+	participants, err := u.selectParticipants(request.Participants)
+	if err != nil {
+		return model.UpgradeStatus{}, err
+	}
+	status := &model.UpgradeStatus{
+		Id:        uuid.New().String(),
+		State:     StateRunning,
+		Request:   request,
+		StartedAt: time.Now(),
+		Total:     len(participants),
+	}
+	for i, participant := range participants {
+		status.Participants = append(status.Participants, model.ParticipantUpgrade{
+			Name:         participant.Definition.ParticipantName,
+			Canary:       i < request.CanarySize,
+			FromRevision: participant.Revision,
+			State:        ParticipantPending,
+		})
+	}
+	u.status = status
+
+	log.Printf("Starting upgrade %s of %d participants\n", status.Id, len(participants))
+	go u.run(request, participants)
+	return u.snapshot(), nil
+}
+
+// Status returns the progress of the current or last upgrade, false if there has not been one
+func (u *Upgrader) Status() (model.UpgradeStatus, bool) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.status == nil {
+		return model.UpgradeStatus{}, false
+	}
+	return u.snapshot(), true
+}
+
+func (u *Upgrader) selectParticipants(names []string) ([]provisioner.ProvisionedParticipant, error) {
+	participants, err := provisioner.ProvisionedParticipants(u.kubeClient, u.ctx)
+	if err != nil {
+		return nil, fmt.Errorf("discover participants: %w", err)
+	}
+	if len(names) == 0 {
+		return participants, nil
+	}
+
+	byName := make(map[string]provisioner.ProvisionedParticipant, len(participants))
+	for _, participant := range participants {
+		byName[participant.Definition.ParticipantName] = participant
+	}
+	selected := make([]provisioner.ProvisionedParticipant, 0, len(names))
+	for _, name := range names {
+		participant, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("participant %s is not provisioned", name)
+		}
+		selected = append(selected, participant)
+	}
+	return selected, nil
+}
+
+func (u *Upgrader) run(request model.UpgradeRequest, participants []provisioner.ProvisionedParticipant) {
+	timeout := time.Duration(request.ReadinessTimeoutSeconds) * time.Second
+	canarySize := min(request.CanarySize, len(participants))
+
+	// a failing canary always stops the upgrade, that is what it is for
+	halted := u.runBatch(participants, 0, canarySize, request.Concurrency, true, timeout)
+	if halted {
+		log.Println("Canary batch failed, halting the upgrade")
+		for i := canarySize; i < len(participants); i++ {
+			u.update(i, ParticipantSkipped, nil)
+		}
+	} else {
+		halted = u.runBatch(participants, canarySize, len(participants), request.Concurrency, !request.ContinueOnFailure, timeout)
+	}
+
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	now := time.Now()
+	u.status.FinishedAt = &now
+	switch {
+	case halted:
+		u.status.State = StateHalted
+	case u.status.Failed > 0:
+		u.status.State = StateFailed
+	default:
+		u.status.State = StateSucceeded
+	}
+	log.Printf("Upgrade %s %s: %d succeeded, %d failed, %d skipped\n", u.status.Id, u.status.State, u.status.Succeeded, u.status.Failed, u.status.Skipped)
+}
+
+// runBatch upgrades the participants in [from, to) with the given concurrency. If haltOnFailure is set, participants
+// that have not been started when the first failure occurs are skipped. It returns true if that happened.
+func (u *Upgrader) runBatch(participants []provisioner.ProvisionedParticipant, from int, to int, concurrency int, haltOnFailure bool, timeout time.Duration) bool {
+	var wg sync.WaitGroup
+	var halt sync.Once
+	halted := make(chan struct{})
+	slots := make(chan struct{}, concurrency)
+
+	for i := from; i < to; i++ {
+		acquired := false
+		select {
+		case slots <- struct{}{}:
+			acquired = true
+		case <-halted:
+		}
+		select {
+		case <-halted:
+			if acquired {
+				<-slots
+			}
+			u.update(i, ParticipantSkipped, nil)
+			continue
+		default:
+		}
+
+		wg.Add(1)
+		go func(index int) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			u.update(index, ParticipantUpgrading, nil)
+			err := u.upgradeParticipant(participants[index].Definition, timeout)
+			if err != nil {
+				log.Printf("Upgrade of participant %s failed: %v\n", participants[index].Definition.ParticipantName, err)
+				u.update(index, ParticipantFailed, err)
+				if haltOnFailure {
+					halt.Do(func() { close(halted) })
+				}
+				return
+			}
+			u.update(index, ParticipantSucceeded, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	select {
+	case <-halted:
+		return true
+	default:
+		return false
+	}
+}
+
+// upgradeParticipant applies the current templates and waits until the participant passes the same readiness gates
+// as after its creation. A zero timeout uses the readiness timeout of the participant's profile.
+func (u *Upgrader) upgradeParticipant(definition model.ParticipantDefinition, timeout time.Duration) error {
+	profile, err := provisioner.LookupProfile(definition.Profile)
+	if err != nil {
+		return err
+	}
+	if timeout <= 0 {
+		timeout = profile.ReadinessTimeout
+	}
+	if timeout <= 0 {
+		timeout = defaultReadinessTimeout
+	}
+	if _, err := u.agent.ApplyResources(definition); err != nil {
+		return err
+	}
+	gates, err := u.agent.ReadinessGates(definition)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(u.ctx, timeout)
+	defer cancel()
+	return readiness.Wait(ctx, definition.ParticipantName, gates)
+}
+
+func (u *Upgrader) update(index int, state string, err error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	participant := &u.status.Participants[index]
+	participant.State = state
+	if err != nil {
+		participant.Error = err.Error()
+		var readinessError *kube.ReadinessError
+		if errors.As(err, &readinessError) {
+			participant.Reason = readinessError.Reason
+		}
+	}
+	switch state {
+	case ParticipantSucceeded:
+		u.status.Succeeded++
+	case ParticipantFailed:
+		u.status.Failed++
+	case ParticipantSkipped:
+		u.status.Skipped++
+	}
+}
+
+// snapshot copies the status, so that it can be serialized while the upgrade continues. The mutex must be held.
+func (u *Upgrader) snapshot() model.UpgradeStatus {
+	status := *u.status
+	status.Participants = append([]model.ParticipantUpgrade(nil), u.status.Participants...)
+	return status
+}